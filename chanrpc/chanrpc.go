@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"github.com/name5566/leaf/conf"
 	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/tracing"
 	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
 // one server per goroutine (goroutine not safe)
@@ -19,13 +22,26 @@ type Server struct {
 	// func(args []interface{}) []interface{}
 	functions map[interface{}]interface{}
 	ChanCall  chan *CallInfo
+	// guards ChanCall, which is replaced by Reopen, and closed. The calls
+	// are sent with the read lock held so that Close never races with them
+	mutexChanCall sync.RWMutex
+	closed        bool
+	// 1 once Close is called, closeSig wakes up the callers waiting for room
+	// in ChanCall
+	closing  int32
+	closeSig chan bool
+	// the span of the call being executed
+	span *tracing.Span
 }
 
 type CallInfo struct {
+	id      interface{}
 	f       interface{}
 	args    []interface{}
 	chanRet chan *RetInfo
 	cb      interface{}
+	// the span of the caller
+	span *tracing.Span
 }
 
 type RetInfo struct {
@@ -39,19 +55,24 @@ type RetInfo struct {
 	// func(ret interface{}, err error)
 	// func(ret []interface{}, err error)
 	cb interface{}
+	// the span of the caller
+	span *tracing.Span
 }
 
 type Client struct {
 	s               *Server
 	chanSyncRet     chan *RetInfo
 	ChanAsynRet     chan *RetInfo
-	pendingAsynCall int
+	pendingAsynCall int32
+	// the parent span of the calls
+	span *tracing.Span
 }
 
 func NewServer(l int) *Server {
 	s := new(Server)
 	s.functions = make(map[interface{}]interface{})
 	s.ChanCall = make(chan *CallInfo, l)
+	s.closeSig = make(chan bool)
 	return s
 }
 
@@ -92,6 +113,7 @@ func (s *Server) ret(ci *CallInfo, ri *RetInfo) (err error) {
 	}()
 
 	ri.cb = ci.cb
+	ri.span = ci.span
 	ci.chanRet <- ri
 	return
 }
@@ -127,28 +149,93 @@ func (s *Server) exec(ci *CallInfo) (err error) {
 	panic("bug")
 }
 
+// the id of the called function
+func (ci *CallInfo) ID() interface{} {
+	return ci.id
+}
+
+// the span of the caller, nil if the call is not traced
+func (ci *CallInfo) Span() *tracing.Span {
+	return ci.span
+}
+
+// the span of the caller, nil if the call is not traced
+func (ri *RetInfo) Span() *tracing.Span {
+	return ri.span
+}
+
 func (s *Server) Exec(ci *CallInfo) {
+	if ci.span != nil {
+		s.span = ci.span.Child(fmt.Sprintf("chanrpc %v", ci.id))
+		// the caller waits for the result of a call, not of a Go
+		if ci.chanRet != nil {
+			s.span.SetKind(tracing.KindServer)
+		} else {
+			s.span.SetKind(tracing.KindConsumer)
+		}
+		defer func() {
+			s.span.End()
+			s.span = nil
+		}()
+	}
+
 	err := s.exec(ci)
 	if err != nil {
 		log.Error("%v", err)
+		s.span.SetError(err)
 	}
 }
 
+// the span of the call being executed by Exec, nil if the call is not
+// traced. The spans of the calls made by the function are its children
+// goroutine not safe (call it from the goroutine of Exec)
+func (s *Server) Span() *tracing.Span {
+	return s.span
+}
+
 // goroutine safe
 func (s *Server) Go(id interface{}, args ...interface{}) {
+	s.GoSpan(nil, id, args...)
+}
+
+// Go with the span of the caller, e.g. the span of a message of the gate
+// goroutine safe
+func (s *Server) GoSpan(span *tracing.Span, id interface{}, args ...interface{}) {
 	f := s.functions[id]
 	if f == nil {
 		return
 	}
 
-	defer func() {
-		recover()
-	}()
-
-	s.ChanCall <- &CallInfo{
+	s.send(&CallInfo{
+		id:   id,
 		f:    f,
 		args: args,
+		span: span,
+	}, true)
+}
+
+// sends ci unless the server is closed, waits for room in ChanCall if block
+func (s *Server) send(ci *CallInfo, block bool) error {
+	s.mutexChanCall.RLock()
+	defer s.mutexChanCall.RUnlock()
+
+	if s.closed {
+		return errors.New("chanrpc server closed")
+	}
+	if block {
+		select {
+		case s.ChanCall <- ci:
+		case <-s.closeSig:
+			return errors.New("chanrpc server closed")
+		}
+	} else {
+		select {
+		case s.ChanCall <- ci:
+		default:
+			return errors.New("chanrpc channel full")
+		}
 	}
+	return nil
 }
 
 // goroutine safe
@@ -167,15 +254,57 @@ func (s *Server) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 }
 
 func (s *Server) Close() {
-	close(s.ChanCall)
-
-	for ci := range s.ChanCall {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return
+	}
+	s.mutexChanCall.RLock()
+	closeSig := s.closeSig
+	s.mutexChanCall.RUnlock()
+	close(closeSig)
+
+	s.mutexChanCall.Lock()
+	s.closed = true
+	chanCall := s.ChanCall
+	close(chanCall)
+	s.mutexChanCall.Unlock()
+
+	for ci := range chanCall {
 		s.ret(ci, &RetInfo{
 			err: errors.New("chanrpc server closed"),
 		})
 	}
 }
 
+// reopens a closed server with the registered functions kept, the calls
+// made while the server is closed are dropped
+// goroutine safe (but not with the goroutine receiving from ChanCall)
+func (s *Server) Reopen() {
+	s.mutexChanCall.Lock()
+	s.ChanCall = make(chan *CallInfo, cap(s.ChanCall))
+	s.closeSig = make(chan bool)
+	s.closed = false
+	atomic.StoreInt32(&s.closing, 0)
+	s.mutexChanCall.Unlock()
+}
+
+func (s *Server) chanCall() chan *CallInfo {
+	s.mutexChanCall.RLock()
+	defer s.mutexChanCall.RUnlock()
+	return s.ChanCall
+}
+
+// the number of calls waiting in ChanCall
+// goroutine safe
+func (s *Server) Len() int {
+	return len(s.chanCall())
+}
+
+// the capacity of ChanCall
+// goroutine safe
+func (s *Server) Cap() int {
+	return cap(s.chanCall())
+}
+
 // goroutine safe
 func (s *Server) Open(l int) *Client {
 	c := NewClient(l)
@@ -194,23 +323,13 @@ func (c *Client) Attach(s *Server) {
 	c.s = s
 }
 
-func (c *Client) call(ci *CallInfo, block bool) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = r.(error)
-		}
-	}()
+// sets the parent span of the following calls, nil for untraced calls
+func (c *Client) SetSpan(span *tracing.Span) {
+	c.span = span
+}
 
-	if block {
-		c.s.ChanCall <- ci
-	} else {
-		select {
-		case c.s.ChanCall <- ci:
-		default:
-			err = errors.New("chanrpc channel full")
-		}
-	}
-	return
+func (c *Client) call(ci *CallInfo, block bool) error {
+	return c.s.send(ci, block)
 }
 
 func (c *Client) f(id interface{}, n int) (f interface{}, err error) {
@@ -250,9 +369,11 @@ func (c *Client) Call0(id interface{}, args ...interface{}) error {
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
+		span:    c.span,
 	}, true)
 	if err != nil {
 		return err
@@ -269,9 +390,11 @@ func (c *Client) Call1(id interface{}, args ...interface{}) (interface{}, error)
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
+		span:    c.span,
 	}, true)
 	if err != nil {
 		return nil, err
@@ -288,9 +411,11 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
+		span:    c.span,
 	}, true)
 	if err != nil {
 		return nil, err
@@ -303,18 +428,20 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 func (c *Client) asynCall(id interface{}, args []interface{}, cb interface{}, n int) {
 	f, err := c.f(id, n)
 	if err != nil {
-		c.ChanAsynRet <- &RetInfo{err: err, cb: cb}
+		c.ChanAsynRet <- &RetInfo{err: err, cb: cb, span: c.span}
 		return
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.ChanAsynRet,
 		cb:      cb,
+		span:    c.span,
 	}, false)
 	if err != nil {
-		c.ChanAsynRet <- &RetInfo{err: err, cb: cb}
+		c.ChanAsynRet <- &RetInfo{err: err, cb: cb, span: c.span}
 		return
 	}
 }
@@ -340,13 +467,13 @@ func (c *Client) AsynCall(id interface{}, _args ...interface{}) {
 	}
 
 	// too many calls
-	if c.pendingAsynCall >= cap(c.ChanAsynRet) {
+	if int(atomic.LoadInt32(&c.pendingAsynCall)) >= cap(c.ChanAsynRet) {
 		execCb(&RetInfo{err: errors.New("too many calls"), cb: cb})
 		return
 	}
 
 	c.asynCall(id, args, cb, n)
-	c.pendingAsynCall++
+	atomic.AddInt32(&c.pendingAsynCall, 1)
 }
 
 func execCb(ri *RetInfo) {
@@ -377,16 +504,22 @@ func execCb(ri *RetInfo) {
 }
 
 func (c *Client) Cb(ri *RetInfo) {
-	c.pendingAsynCall--
+	atomic.AddInt32(&c.pendingAsynCall, -1)
 	execCb(ri)
 }
 
 func (c *Client) Close() {
-	for c.pendingAsynCall > 0 {
+	for atomic.LoadInt32(&c.pendingAsynCall) > 0 {
 		c.Cb(<-c.ChanAsynRet)
 	}
 }
 
 func (c *Client) Idle() bool {
-	return c.pendingAsynCall == 0
+	return atomic.LoadInt32(&c.pendingAsynCall) == 0
+}
+
+// the number of asynchronous calls waiting for their callback
+// goroutine safe
+func (c *Client) PendingAsynCall() int {
+	return int(atomic.LoadInt32(&c.pendingAsynCall))
 }
@@ -10,30 +10,46 @@ import (
 var (
 	server  *network.TCPServer
 	clients []*network.TCPClient
+	// the addresses given to InitConfig
+	listenAddr string
+	connAddrs  []string
 )
 
+// Init sets up the connections with the settings of the conf variables
 func Init() {
-	if conf.ListenAddr != "" {
+	InitConfig(conf.Default())
+}
+
+// InitConfig sets up the connections with the cluster settings of c
+func InitConfig(c *conf.Config) {
+	listenAddr = c.ListenAddr
+	connAddrs = append([]string(nil), c.ConnAddrs...)
+
+	if c.ListenAddr != "" {
 		server = new(network.TCPServer)
-		server.Addr = conf.ListenAddr
+		server.Addr = c.ListenAddr
 		server.MaxConnNum = int(math.MaxInt32)
-		server.PendingWriteNum = conf.PendingWriteNum
+		server.PendingWriteNum = c.PendingWriteNum
 		server.LenMsgLen = 4
 		server.MaxMsgLen = math.MaxUint32
-		server.NewAgent = newAgent
+		server.NewAgent = func(conn *network.TCPConn) network.Agent {
+			return newAgent(conn, "")
+		}
 
 		server.Start()
 	}
 
-	for _, addr := range conf.ConnAddrs {
+	for _, addr := range c.ConnAddrs {
 		client := new(network.TCPClient)
 		client.Addr = addr
 		client.ConnNum = 1
 		client.ConnectInterval = 3 * time.Second
-		client.PendingWriteNum = conf.PendingWriteNum
+		client.PendingWriteNum = c.PendingWriteNum
 		client.LenMsgLen = 4
 		client.MaxMsgLen = math.MaxUint32
-		client.NewAgent = newAgent
+		client.NewAgent = func(conn *network.TCPConn) network.Agent {
+			return newAgent(conn, client.Addr)
+		}
 
 		client.Start()
 		clients = append(clients, client)
@@ -50,16 +66,24 @@ func Destroy() {
 	}
 }
 
+// no message is exchanged between the servers yet, so no trace is continued.
+// The messages added must carry the Traceparent of the span of the sender,
+// continued with tracing.StartRemote by the receiver
 type Agent struct {
 	conn *network.TCPConn
+	peer peerKey
 }
 
-func newAgent(conn *network.TCPConn) network.Agent {
+func newAgent(conn *network.TCPConn, addr string) network.Agent {
 	a := new(Agent)
 	a.conn = conn
+	a.peer = newPeerKey(conn, addr)
+	addAgent(a)
 	return a
 }
 
 func (a *Agent) Run() {}
 
-func (a *Agent) OnClose() {}
+func (a *Agent) OnClose() {
+	removeAgent(a)
+}
@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"github.com/name5566/leaf/console"
+	"github.com/name5566/leaf/network"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the status of a peer. The cluster links carry no messages yet and a
+// connection is closed once established, so Connects and LastConnect tell
+// whether a peer is reachable
+type PeerStat struct {
+	// the remote host of an inbound peer, or an address of ConnAddrs
+	Addr    string
+	Inbound bool
+	// whether a connection is open, and since when
+	Connected bool
+	Since     time.Time
+	// the connections established since cluster.Init
+	Connects    int
+	LastConnect time.Time
+}
+
+type peerKey struct {
+	addr    string
+	inbound bool
+}
+
+type peer struct {
+	open     int
+	since    time.Time
+	connects int
+	last     time.Time
+}
+
+var (
+	peers      = make(map[peerKey]*peer)
+	mutexPeers sync.Mutex
+)
+
+func init() {
+	console.RegisterFunc("cluster", "status of the cluster peers", commandCluster)
+}
+
+// addr is the address of ConnAddrs, empty for an inbound connection
+func newPeerKey(conn *network.TCPConn, addr string) peerKey {
+	if addr != "" {
+		return peerKey{addr: addr}
+	}
+	host := conn.RemoteAddr().String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return peerKey{addr: host, inbound: true}
+}
+
+func addAgent(a *Agent) {
+	mutexPeers.Lock()
+	defer mutexPeers.Unlock()
+
+	p := peers[a.peer]
+	if p == nil {
+		p = new(peer)
+		peers[a.peer] = p
+	}
+	now := time.Now()
+	if p.open == 0 {
+		p.since = now
+	}
+	p.open++
+	p.connects++
+	p.last = now
+}
+
+func removeAgent(a *Agent) {
+	mutexPeers.Lock()
+	peers[a.peer].open--
+	mutexPeers.Unlock()
+}
+
+// the inbound peers connected since cluster.Init and the peers of
+// ConnAddrs, connected or not
+// goroutine safe
+func PeerStats() []PeerStat {
+	mutexPeers.Lock()
+	defer mutexPeers.Unlock()
+
+	var stats []PeerStat
+	for k, p := range peers {
+		if k.inbound {
+			stats = append(stats, newPeerStat(k, p))
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Addr < stats[j].Addr
+	})
+
+	for _, addr := range connAddrs {
+		k := peerKey{addr: addr}
+		if p, ok := peers[k]; ok {
+			stats = append(stats, newPeerStat(k, p))
+		} else {
+			stats = append(stats, PeerStat{Addr: addr})
+		}
+	}
+	return stats
+}
+
+func newPeerStat(k peerKey, p *peer) PeerStat {
+	s := PeerStat{
+		Addr:        k.addr,
+		Inbound:     k.inbound,
+		Connected:   p.open > 0,
+		Connects:    p.connects,
+		LastConnect: p.last,
+	}
+	if s.Connected {
+		s.Since = p.since
+	}
+	return s
+}
+
+func commandCluster(args []string) string {
+	var lines []string
+	if listenAddr != "" {
+		lines = append(lines, "listening on "+listenAddr)
+	}
+	for _, s := range PeerStats() {
+		line := "out "
+		if s.Inbound {
+			line = "in  "
+		}
+		line += s.Addr + " - "
+		if s.Connected {
+			line += "connected for " + time.Since(s.Since).Truncate(time.Second).String()
+		} else if s.Connects > 0 {
+			line += "disconnected"
+		} else {
+			line += "never connected"
+		}
+		if s.Connects > 0 {
+			line += ", " + strconv.Itoa(s.Connects) + " connections, last " +
+				time.Since(s.LastConnect).Truncate(time.Second).String() + " ago"
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "cluster disabled (ListenAddr and ConnAddrs are not set)"
+	}
+	return strings.Join(lines, "\r\n")
+}
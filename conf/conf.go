@@ -1,20 +1,91 @@
 package conf
 
+import (
+	"os"
+	"time"
+)
+
 var (
 	LenStackBuf = 4096
 
+	// shutdown
+	// (default: os.Interrupt and syscall.SIGTERM)
+	CloseSignals []os.Signal
+	// 0 means no deadline
+	CloseTimeout time.Duration
+
+	// module
+	StallThreshold time.Duration
+
 	// log
 	LogLevel string
 	LogPath  string
 	LogFlag  int
+	// levels of packages, e.g. {"gate": "debug"}, see log.SetPackageLevel
+	LogPackageLevels map[string]string
+	// text (default) or json
+	LogFormat string
+	// rotation and retention of the files in LogPath, 0 means no limit
+	LogMaxSize        int // megabytes
+	LogRotateInterval time.Duration
+	LogMaxBackups     int
+	LogMaxAge         time.Duration
+	LogCompress       bool
+	// the prefix of the file names, only the files with the prefix are
+	// removed by LogMaxBackups and LogMaxAge
+	LogPrefix string
+	// also log to stdout from the level when LogPath is set
+	LogStdoutLevel string
+	// write the lines from a goroutine buffering LogAsync lines, 0 means
+	// synchronous writes. LogOverflow is block (default), drop or report
+	LogAsync    int
+	LogOverflow string
+	// suppress the repeats of a line within LogDedupWindow, and log at most
+	// LogSampleFirst lines of a call site in every LogSampleInterval, then
+	// every LogSampleThereafter-th line, see log.SetDedup and log.SetSampling
+	LogDedupWindow      time.Duration
+	LogSampleInterval   time.Duration
+	LogSampleFirst      int
+	LogSampleThereafter int
 
 	// console
 	ConsolePort   int
 	ConsolePrompt string = "Leaf# "
 	ProfilePath   string
+	// the host the console listens on (default: localhost)
+	ConsoleAddr string
+	// the console accepts TLS connections if both files are set
+	ConsoleTLSCert string
+	ConsoleTLSKey  string
+	// a login is required if there are users
+	ConsoleUsers []ConsoleUser
+	// the role required to run a command, e.g. {"reload": "admin"}
+	ConsoleCommandRoles map[string]string
+	// the port of the HTTP/JSON admin API, 0 disables it
+	ConsoleHTTPPort int
+
+	// metrics, e.g. localhost:9100, empty disables /metrics
+	MetricsAddr string
+
+	// tracing: the spans are exported in the OTLP/JSON format, appended to
+	// TraceFile (one request per line) and/or posted to TraceCollector, e.g.
+	// http://localhost:4318/v1/traces. Both empty disables tracing
+	TraceFile        string
+	TraceCollector   string
+	TraceServiceName string
+	// the fraction of the traces started which are recorded
+	TraceSampleRate float64 = 1
 
 	// cluster
 	ListenAddr      string
 	ConnAddrs       []string
 	PendingWriteNum int
 )
+
+// a login of the console: login name password, or login token for a user
+// without name. The password may be given as sha256:<hex digest>
+type ConsoleUser struct {
+	Name     string
+	Password string
+	Roles    []string
+}
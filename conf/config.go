@@ -0,0 +1,321 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Leaf settings, loaded by Load and passed to leaf.RunConfig
+type Config struct {
+	LenStackBuf int
+
+	// module
+	StallThreshold Duration
+
+	// shutdown
+	CloseTimeout Duration
+
+	// log
+	LogLevel          string
+	LogPath           string
+	LogFlag           int
+	LogPackageLevels  map[string]string
+	LogFormat         string
+	LogMaxSize        int
+	LogRotateInterval Duration
+	LogMaxBackups     int
+	LogMaxAge         Duration
+	LogCompress       bool
+	LogPrefix         string
+	LogStdoutLevel    string
+	LogAsync          int
+	LogOverflow       string
+
+	LogDedupWindow      Duration
+	LogSampleInterval   Duration
+	LogSampleFirst      int
+	LogSampleThereafter int
+
+	// console
+	ConsolePort         int
+	ConsolePrompt       string
+	ProfilePath         string
+	ConsoleAddr         string
+	ConsoleTLSCert      string
+	ConsoleTLSKey       string
+	ConsoleUsers        []ConsoleUser
+	ConsoleCommandRoles map[string]string
+	ConsoleHTTPPort     int
+
+	// metrics
+	MetricsAddr string
+
+	// tracing
+	TraceFile        string
+	TraceCollector   string
+	TraceServiceName string
+	TraceSampleRate  float64
+
+	// cluster
+	ListenAddr      string
+	ConnAddrs       []string
+	PendingWriteNum int
+}
+
+// a time.Duration read from "10s" or from nanoseconds
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		return d.parse(s)
+	}
+
+	var n int64
+	err := json.Unmarshal(data, &n)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	*d = Duration(n)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// the current settings
+func Default() *Config {
+	c := new(Config)
+	c.LenStackBuf = LenStackBuf
+	c.StallThreshold = Duration(StallThreshold)
+	c.CloseTimeout = Duration(CloseTimeout)
+	c.LogLevel = LogLevel
+	c.LogPath = LogPath
+	c.LogFlag = LogFlag
+	if LogPackageLevels != nil {
+		c.LogPackageLevels = make(map[string]string, len(LogPackageLevels))
+		for pkg, level := range LogPackageLevels {
+			c.LogPackageLevels[pkg] = level
+		}
+	}
+	c.LogFormat = LogFormat
+	c.LogMaxSize = LogMaxSize
+	c.LogRotateInterval = Duration(LogRotateInterval)
+	c.LogMaxBackups = LogMaxBackups
+	c.LogMaxAge = Duration(LogMaxAge)
+	c.LogCompress = LogCompress
+	c.LogPrefix = LogPrefix
+	c.LogStdoutLevel = LogStdoutLevel
+	c.LogAsync = LogAsync
+	c.LogOverflow = LogOverflow
+	c.LogDedupWindow = Duration(LogDedupWindow)
+	c.LogSampleInterval = Duration(LogSampleInterval)
+	c.LogSampleFirst = LogSampleFirst
+	c.LogSampleThereafter = LogSampleThereafter
+	c.ConsolePort = ConsolePort
+	c.ConsolePrompt = ConsolePrompt
+	c.ProfilePath = ProfilePath
+	c.ConsoleAddr = ConsoleAddr
+	c.ConsoleTLSCert = ConsoleTLSCert
+	c.ConsoleTLSKey = ConsoleTLSKey
+	c.ConsoleUsers = append([]ConsoleUser(nil), ConsoleUsers...)
+	if ConsoleCommandRoles != nil {
+		c.ConsoleCommandRoles = make(map[string]string, len(ConsoleCommandRoles))
+		for name, role := range ConsoleCommandRoles {
+			c.ConsoleCommandRoles[name] = role
+		}
+	}
+	c.ConsoleHTTPPort = ConsoleHTTPPort
+	c.MetricsAddr = MetricsAddr
+	c.TraceFile = TraceFile
+	c.TraceCollector = TraceCollector
+	c.TraceServiceName = TraceServiceName
+	c.TraceSampleRate = TraceSampleRate
+	c.ListenAddr = ListenAddr
+	c.ConnAddrs = append([]string(nil), ConnAddrs...)
+	c.PendingWriteNum = PendingWriteNum
+	return c
+}
+
+// Apply sets the conf variables, read by leaf.Run, to the settings c.
+// leaf.RunConfig does not need it
+// you must call the function before calling leaf.Run
+func (c *Config) Apply() {
+	LenStackBuf = c.LenStackBuf
+	StallThreshold = time.Duration(c.StallThreshold)
+	CloseTimeout = time.Duration(c.CloseTimeout)
+	LogLevel = c.LogLevel
+	LogPath = c.LogPath
+	LogFlag = c.LogFlag
+	LogPackageLevels = c.LogPackageLevels
+	LogFormat = c.LogFormat
+	LogMaxSize = c.LogMaxSize
+	LogRotateInterval = time.Duration(c.LogRotateInterval)
+	LogMaxBackups = c.LogMaxBackups
+	LogMaxAge = time.Duration(c.LogMaxAge)
+	LogCompress = c.LogCompress
+	LogPrefix = c.LogPrefix
+	LogStdoutLevel = c.LogStdoutLevel
+	LogAsync = c.LogAsync
+	LogOverflow = c.LogOverflow
+	LogDedupWindow = time.Duration(c.LogDedupWindow)
+	LogSampleInterval = time.Duration(c.LogSampleInterval)
+	LogSampleFirst = c.LogSampleFirst
+	LogSampleThereafter = c.LogSampleThereafter
+	ConsolePort = c.ConsolePort
+	ConsolePrompt = c.ConsolePrompt
+	ProfilePath = c.ProfilePath
+	ConsoleAddr = c.ConsoleAddr
+	ConsoleTLSCert = c.ConsoleTLSCert
+	ConsoleTLSKey = c.ConsoleTLSKey
+	ConsoleUsers = c.ConsoleUsers
+	ConsoleCommandRoles = c.ConsoleCommandRoles
+	ConsoleHTTPPort = c.ConsoleHTTPPort
+	MetricsAddr = c.MetricsAddr
+	TraceFile = c.TraceFile
+	TraceCollector = c.TraceCollector
+	TraceServiceName = c.TraceServiceName
+	TraceSampleRate = c.TraceSampleRate
+	ListenAddr = c.ListenAddr
+	ConnAddrs = c.ConnAddrs
+	PendingWriteNum = c.PendingWriteNum
+}
+
+func validLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "", "trace", "debug", "release", "error", "fatal":
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Config) Validate() error {
+	var errs []string
+	if !validLevel(c.LogLevel) {
+		errs = append(errs, fmt.Sprintf("LogLevel: unknown level %q (trace, debug, release, error or fatal)", c.LogLevel))
+	}
+	pkgs := make([]string, 0, len(c.LogPackageLevels))
+	for pkg := range c.LogPackageLevels {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		if level := c.LogPackageLevels[pkg]; level == "" || !validLevel(level) {
+			errs = append(errs, fmt.Sprintf("LogPackageLevels[%v]: unknown level %q (trace, debug, release, error or fatal)", pkg, level))
+		}
+	}
+	if !validLevel(c.LogStdoutLevel) {
+		errs = append(errs, fmt.Sprintf("LogStdoutLevel: unknown level %q (trace, debug, release, error or fatal)", c.LogStdoutLevel))
+	}
+	if c.LogMaxSize < 0 {
+		errs = append(errs, fmt.Sprintf("LogMaxSize: must not be negative (got %v)", c.LogMaxSize))
+	}
+	if c.LogRotateInterval < 0 {
+		errs = append(errs, fmt.Sprintf("LogRotateInterval: must not be negative (got %v)", c.LogRotateInterval))
+	}
+	if c.LogMaxBackups < 0 {
+		errs = append(errs, fmt.Sprintf("LogMaxBackups: must not be negative (got %v)", c.LogMaxBackups))
+	}
+	if c.LogMaxAge < 0 {
+		errs = append(errs, fmt.Sprintf("LogMaxAge: must not be negative (got %v)", c.LogMaxAge))
+	}
+	if strings.ContainsAny(c.LogPrefix, `/\`) {
+		errs = append(errs, fmt.Sprintf("LogPrefix: must not contain a path separator (got %q)", c.LogPrefix))
+	}
+	if c.LogAsync < 0 {
+		errs = append(errs, fmt.Sprintf("LogAsync: must not be negative (got %v)", c.LogAsync))
+	}
+	switch strings.ToLower(c.LogOverflow) {
+	case "", "block", "drop", "report":
+	default:
+		errs = append(errs, fmt.Sprintf("LogOverflow: unknown policy %q (block, drop or report)", c.LogOverflow))
+	}
+	if c.LogDedupWindow < 0 {
+		errs = append(errs, fmt.Sprintf("LogDedupWindow: must not be negative (got %v)", c.LogDedupWindow))
+	}
+	if c.LogSampleInterval < 0 {
+		errs = append(errs, fmt.Sprintf("LogSampleInterval: must not be negative (got %v)", c.LogSampleInterval))
+	}
+	if c.LogSampleFirst < 0 {
+		errs = append(errs, fmt.Sprintf("LogSampleFirst: must not be negative (got %v)", c.LogSampleFirst))
+	}
+	if c.LogSampleThereafter < 0 {
+		errs = append(errs, fmt.Sprintf("LogSampleThereafter: must not be negative (got %v)", c.LogSampleThereafter))
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "", "text", "json":
+	default:
+		errs = append(errs, fmt.Sprintf("LogFormat: unknown format %q (text or json)", c.LogFormat))
+	}
+	if c.LenStackBuf < 0 {
+		errs = append(errs, fmt.Sprintf("LenStackBuf: must not be negative (got %v)", c.LenStackBuf))
+	}
+	if c.StallThreshold < 0 {
+		errs = append(errs, fmt.Sprintf("StallThreshold: must not be negative (got %v)", c.StallThreshold))
+	}
+	if c.CloseTimeout < 0 {
+		errs = append(errs, fmt.Sprintf("CloseTimeout: must not be negative (got %v)", c.CloseTimeout))
+	}
+	if c.ConsolePort < 0 || c.ConsolePort > 65535 {
+		errs = append(errs, fmt.Sprintf("ConsolePort: must be in [0, 65535] (got %v)", c.ConsolePort))
+	}
+	if c.ConsoleHTTPPort < 0 || c.ConsoleHTTPPort > 65535 {
+		errs = append(errs, fmt.Sprintf("ConsoleHTTPPort: must be in [0, 65535] (got %v)", c.ConsoleHTTPPort))
+	}
+	if c.ConsoleHTTPPort != 0 && c.ConsoleHTTPPort == c.ConsolePort {
+		errs = append(errs, fmt.Sprintf("ConsoleHTTPPort: must differ from ConsolePort (got %v)", c.ConsoleHTTPPort))
+	}
+	if (c.ConsoleTLSCert == "") != (c.ConsoleTLSKey == "") {
+		errs = append(errs, "ConsoleTLSCert, ConsoleTLSKey: must be set together")
+	}
+	names := make(map[string]bool)
+	for i, u := range c.ConsoleUsers {
+		if u.Password == "" {
+			errs = append(errs, fmt.Sprintf("ConsoleUsers[%v].Password: must not be empty", i))
+		}
+		if names[u.Name] && u.Name != "" {
+			errs = append(errs, fmt.Sprintf("ConsoleUsers[%v].Name: duplicate user %v", i, u.Name))
+		}
+		names[u.Name] = true
+	}
+	if c.TraceCollector != "" {
+		if u, err := url.Parse(c.TraceCollector); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("TraceCollector: must be an http or https URL (got %q)", c.TraceCollector))
+		}
+	}
+	if c.TraceSampleRate < 0 || c.TraceSampleRate > 1 {
+		errs = append(errs, fmt.Sprintf("TraceSampleRate: must be in [0, 1] (got %v)", c.TraceSampleRate))
+	}
+	if c.PendingWriteNum < 0 {
+		errs = append(errs, fmt.Sprintf("PendingWriteNum: must not be negative (got %v)", c.PendingWriteNum))
+	}
+	for i, addr := range c.ConnAddrs {
+		if addr == "" {
+			errs = append(errs, fmt.Sprintf("ConnAddrs[%v]: must not be empty", i))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
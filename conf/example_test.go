@@ -0,0 +1,54 @@
+package conf_test
+
+import (
+	"fmt"
+	"github.com/name5566/leaf/conf"
+	"os"
+)
+
+type Game struct {
+	MaxPlayers int    `validate:"min=1"`
+	Mode       string `validate:"oneof=pve|pvp"`
+	DB         struct {
+		URL string `validate:"required"`
+	}
+}
+
+func Example() {
+	var game Game
+
+	c, err := conf.Load("test.yaml", &game)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(c.LogLevel)
+	fmt.Println(c.CloseTimeout)
+	fmt.Println(c.ConsolePort)
+	fmt.Println(game.MaxPlayers)
+	fmt.Println(game.DB.URL)
+
+	// Output:
+	// release
+	// 30s
+	// 3333
+	// 1000
+	// mongodb://localhost
+}
+
+func ExampleLoad_env() {
+	os.Setenv("LEAF_LOGLEVEL", "verbose")
+	os.Setenv("GAME_MAXPLAYERS", "0")
+	defer os.Unsetenv("LEAF_LOGLEVEL")
+	defer os.Unsetenv("GAME_MAXPLAYERS")
+
+	var game Game
+	_, err := conf.Load("test.yaml", &game)
+	fmt.Println(err)
+
+	// Output:
+	// invalid config test.yaml:
+	//   Leaf.LogLevel: unknown level "verbose" (trace, debug, release, error or fatal)
+	//   MaxPlayers: value must be >= 1 (got 0)
+}
@@ -0,0 +1,363 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// environment variables named EnvPrefix + "_" + the upper case path of a field
+// override the game settings, e.g. GAME_MAXPLAYERS or GAME_DB_URL.
+// Leaf settings are overridden by LEAF_ + the upper case name of a setting,
+// e.g. LEAF_LOGLEVEL
+var EnvPrefix = "GAME"
+
+// the game settings may implement Validator, Validate is called after the
+// settings are loaded
+type Validator interface {
+	Validate() error
+}
+
+type ValidationError struct {
+	File   string
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	s := "invalid config"
+	if e.File != "" {
+		s += " " + e.File
+	}
+	return s + ":\n  " + strings.Join(e.Errors, "\n  ")
+}
+
+// Load reads a JSON (.json), YAML (.yaml, .yml) or TOML (.toml) file. Leaf
+// settings are read from the "Leaf" section into a copy of the current
+// settings, game settings are read from the whole file into game (a pointer
+// to a struct, may be nil).
+//
+// Fields of game may be validated with the tag validate, e.g.
+// `validate:"required,min=1,max=100,oneof=a|b"`
+func Load(name string, game interface{}) (*Config, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = toJSON(data, path.Ext(name))
+	if err != nil {
+		return nil, fmt.Errorf("parse config %v error: %v", name, err)
+	}
+
+	// leaf
+	var doc struct {
+		Leaf json.RawMessage
+	}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("parse config %v error: %v", name, err)
+	}
+	c := Default()
+	if len(doc.Leaf) > 0 {
+		// the maps of the file replace the current ones
+		v := reflect.ValueOf(c).Elem()
+		maps := make(map[int]reflect.Value)
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Kind() == reflect.Map {
+				maps[i] = reflect.ValueOf(f.Interface())
+				f.Set(reflect.Zero(f.Type()))
+			}
+		}
+		d := json.NewDecoder(bytes.NewReader(doc.Leaf))
+		d.DisallowUnknownFields()
+		err = d.Decode(c)
+		if err != nil {
+			return nil, fmt.Errorf("parse config %v error: Leaf: %v", name, err)
+		}
+		for i, m := range maps {
+			if v.Field(i).IsNil() {
+				v.Field(i).Set(m)
+			}
+		}
+	}
+
+	// game
+	if game != nil {
+		v := reflect.ValueOf(game)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			return nil, errors.New("game must be a pointer to a struct")
+		}
+		err = json.Unmarshal(data, game)
+		if err != nil {
+			return nil, fmt.Errorf("parse config %v error: %v", name, err)
+		}
+	}
+
+	// environment
+	var errs []string
+	overrideEnv(reflect.ValueOf(c).Elem(), "LEAF", "Leaf.", &errs)
+	if game != nil && EnvPrefix != "" {
+		overrideEnv(reflect.ValueOf(game).Elem(), EnvPrefix, "", &errs)
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{File: name, Errors: errs}
+	}
+
+	// validate
+	if err := c.Validate(); err != nil {
+		for _, e := range err.(*ValidationError).Errors {
+			errs = append(errs, "Leaf."+e)
+		}
+	}
+	if game != nil {
+		validate(reflect.ValueOf(game).Elem(), "", &errs)
+		if v, ok := game.(Validator); ok {
+			if err := v.Validate(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{File: name, Errors: errs}
+	}
+
+	return c, nil
+}
+
+// converts YAML and TOML to JSON so that all formats map to structs alike
+func toJSON(data []byte, ext string) ([]byte, error) {
+	var v interface{}
+	switch strings.ToLower(ext) {
+	case ".json":
+		return data, nil
+	case ".yaml", ".yml":
+		err := yaml.Unmarshal(data, &v)
+		if err != nil {
+			return nil, err
+		}
+		v, err = stringKeys(v)
+		if err != nil {
+			return nil, err
+		}
+	case ".toml":
+		m := make(map[string]interface{})
+		_, err := toml.Decode(string(data), &m)
+		if err != nil {
+			return nil, err
+		}
+		v = m
+	default:
+		return nil, fmt.Errorf("unknown format %q", ext)
+	}
+
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+	return json.Marshal(v)
+}
+
+func stringKeys(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			e, err := stringKeys(e)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = e
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range v {
+			e, err := stringKeys(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+	}
+	return v, nil
+}
+
+func fieldName(f reflect.StructField) string {
+	if tag := f.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+var typeDuration = reflect.TypeOf(Duration(0))
+
+func overrideEnv(v reflect.Value, env string, path string, errs *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+			continue
+		}
+		name := fieldName(f)
+		fieldEnv := env + "_" + strings.ToUpper(name)
+		fieldPath := path + name
+		field := v.Field(i)
+
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) {
+			overrideEnv(field, fieldEnv, fieldPath+".", errs)
+			continue
+		}
+
+		s, ok := os.LookupEnv(fieldEnv)
+		if !ok {
+			continue
+		}
+		err := setString(field, s)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%v: invalid value %q from %v: %v", fieldPath, s, fieldEnv, err))
+		}
+	}
+}
+
+func setString(field reflect.Value, s string) error {
+	if field.Type() == typeDuration || field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(v)
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(s, "[") {
+			field.Set(reflect.ValueOf(strings.Split(s, ",")).Convert(field.Type()))
+			return nil
+		}
+		return json.Unmarshal([]byte(s), field.Addr().Interface())
+	default:
+		return json.Unmarshal([]byte(s), field.Addr().Interface())
+	}
+	return nil
+}
+
+func validate(v reflect.Value, path string, errs *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fieldPath := path + fieldName(f)
+		field := v.Field(i)
+
+		tag := f.Tag.Get("validate")
+		if tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				err := check(field, rule)
+				if err != nil {
+					*errs = append(*errs, fieldPath+": "+err.Error())
+				}
+			}
+		}
+
+		if f.Type.Kind() == reflect.Struct {
+			validate(field, fieldPath+".", errs)
+		}
+	}
+}
+
+func check(field reflect.Value, rule string) error {
+	name := rule
+	arg := ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name = rule[:i]
+		arg = rule[i+1:]
+	}
+
+	switch name {
+	case "required":
+		if field.IsZero() {
+			return errors.New("required")
+		}
+		return nil
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid rule %q", rule)
+		}
+		n, what, ok := number(field)
+		if !ok {
+			return fmt.Errorf("rule %q not supported by %v", rule, field.Type())
+		}
+		if name == "min" && n < limit {
+			return fmt.Errorf("%v must be >= %v (got %v)", what, arg, n)
+		}
+		if name == "max" && n > limit {
+			return fmt.Errorf("%v must be <= %v (got %v)", what, arg, n)
+		}
+		return nil
+	case "oneof":
+		s := fmt.Sprint(field.Interface())
+		for _, e := range strings.Split(arg, "|") {
+			if s == e {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v (got %q)", strings.Replace(arg, "|", ", ", -1), s)
+	default:
+		return fmt.Errorf("unknown rule %q", rule)
+	}
+}
+
+func number(field reflect.Value) (float64, string, bool) {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int()), "value", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint()), "value", true
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), "value", true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(field.Len()), "length", true
+	default:
+		return 0, "", false
+	}
+}
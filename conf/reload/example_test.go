@@ -0,0 +1,55 @@
+package reload_test
+
+import (
+	"fmt"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/conf/reload"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func Example() {
+	type Game struct {
+		MaxPlayers int
+		Region     string `reload:"false"`
+	}
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "server.json")
+
+	ioutil.WriteFile(name, []byte(`{"MaxPlayers": 100, "Region": "eu"}`), 0644)
+	_, err = reload.Load(name, &Game{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// a module subscribes through its chanrpc server
+	s := chanrpc.NewServer(1)
+	s.Register(reload.ChanRPCID, func(args []interface{}) {
+		e := args[0].(*reload.Event)
+		fmt.Println(e.Game.(*Game).MaxPlayers)
+	})
+	reload.Subscribe(s)
+
+	ioutil.WriteFile(name, []byte(`{"MaxPlayers": 200, "Region": "eu"}`), 0644)
+	_, err = reload.Reload()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	s.Exec(<-s.ChanCall)
+
+	ioutil.WriteFile(name, []byte(`{"MaxPlayers": 200, "Region": "us"}`), 0644)
+	_, err = reload.Reload()
+	fmt.Println(err != nil)
+
+	// Output:
+	// 200
+	// true
+}
@@ -0,0 +1,328 @@
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/console"
+	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/tracing"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the function id called on subscribed servers with an *Event
+const ChanRPCID = "ConfigChanged"
+
+type Change struct {
+	// e.g. Leaf.LogLevel or DB.URL
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+type Event struct {
+	Config *conf.Config
+	// a new value of the type passed to Load, never modified by Leaf
+	Game    interface{}
+	Changes []Change
+}
+
+// Leaf settings which can be changed while the server is running
+var reloadable = map[string]bool{
+	"LogLevel":            true,
+	"LogPackageLevels":    true,
+	"LogDedupWindow":      true,
+	"LogSampleInterval":   true,
+	"LogSampleFirst":      true,
+	"LogSampleThereafter": true,
+	"TraceSampleRate":     true,
+}
+
+var reasons = map[string]string{
+	"LogPath":           "the log file is created at startup",
+	"LogFlag":           "the logger is created at startup",
+	"LogFormat":         "the logger is created at startup",
+	"LogMaxSize":        "the logger is created at startup",
+	"LogRotateInterval": "the logger is created at startup",
+	"LogMaxBackups":     "the logger is created at startup",
+	"LogMaxAge":         "the logger is created at startup",
+	"LogCompress":       "the logger is created at startup",
+	"LogPrefix":         "the logger is created at startup",
+	"LogStdoutLevel":    "the logger is created at startup",
+	"LogAsync":          "the logger is created at startup",
+	"LogOverflow":       "the logger is created at startup",
+	"ConsolePort":       "the console listener is started at startup",
+	"ConsoleAddr":       "the console listener is started at startup",
+	"ConsoleTLSCert":    "the console listener is started at startup",
+	"ConsoleTLSKey":     "the console listener is started at startup",
+	"ConsoleHTTPPort":   "the console listener is started at startup",
+	"MetricsAddr":       "the metrics listener is started at startup",
+	"TraceFile":         "the trace exporter is started at startup",
+	"TraceCollector":    "the trace exporter is started at startup",
+	"TraceServiceName":  "the trace exporter is started at startup",
+	"ListenAddr":        "cluster connections are set up at startup",
+	"ConnAddrs":         "cluster connections are set up at startup",
+	"PendingWriteNum":   "cluster connections are set up at startup",
+}
+
+var (
+	mutex   sync.Mutex
+	name    string
+	config  *conf.Config
+	game    interface{}
+	servers []*chanrpc.Server
+	modTime time.Time
+	closing chan bool
+)
+
+func init() {
+	console.RegisterFunc("reload", "reloads the config file", commandReload)
+}
+
+// Load loads a config file with conf.Load and remembers it for Reload
+func Load(_name string, _game interface{}) (*conf.Config, error) {
+	c, err := conf.Load(_name, _game)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	name = _name
+	config = c
+	game = _game
+	if fi, err := os.Stat(name); err == nil {
+		modTime = fi.ModTime()
+	}
+	return c, nil
+}
+
+// the server receives an *Event via ChanRPCID after every successful reload
+// goroutine safe
+func Subscribe(server *chanrpc.Server) {
+	mutex.Lock()
+	servers = append(servers, server)
+	mutex.Unlock()
+}
+
+// Reload reads the config file again. The reload is rejected and the current
+// settings are kept if the file is invalid or a setting which cannot be
+// reloaded has changed
+// goroutine safe
+func Reload() (*Event, error) {
+	e, subscribers, err := reload()
+	if err != nil {
+		return nil, err
+	}
+
+	// sent without the lock, a subscriber may call Reload
+	if len(e.Changes) > 0 {
+		for _, s := range subscribers {
+			s.Go(ChanRPCID, e)
+		}
+	}
+	return e, nil
+}
+
+// applies the settings read again, returns the servers to notify
+func reload() (*Event, []*chanrpc.Server, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if name == "" {
+		return nil, nil, errors.New("no config file loaded")
+	}
+
+	var newGame interface{}
+	if game != nil {
+		newGame = reflect.New(reflect.TypeOf(game).Elem()).Interface()
+	}
+	c, err := conf.Load(name, newGame)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi, err := os.Stat(name); err == nil {
+		modTime = fi.ModTime()
+	}
+
+	var changes []Change
+	var fixed []string
+	var rejected []string
+	diff(reflect.ValueOf(config).Elem(), reflect.ValueOf(c).Elem(), "Leaf.", false, &changes, &fixed)
+	for _, change := range changes {
+		key := strings.TrimPrefix(change.Key, "Leaf.")
+		if reloadable[key] {
+			continue
+		}
+		reason := reasons[key]
+		if reason == "" {
+			reason = "the setting is read without synchronization"
+		}
+		rejected = append(rejected, fmt.Sprintf("%v: cannot be reloaded, %v", change.Key, reason))
+	}
+	if game != nil {
+		diff(reflect.ValueOf(game).Elem(), reflect.ValueOf(newGame).Elem(), "", false, &changes, &fixed)
+		for _, key := range fixed {
+			rejected = append(rejected, fmt.Sprintf("%v: cannot be reloaded, tagged reload:\"false\"", key))
+		}
+	}
+	if len(rejected) > 0 {
+		return nil, nil, fmt.Errorf("reload %v rejected:\n  %v", name, strings.Join(rejected, "\n  "))
+	}
+
+	// apply
+	if c.LogLevel != config.LogLevel {
+		if c.LogLevel != "" {
+			err := log.SetLevel(c.LogLevel)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if !reflect.DeepEqual(c.LogPackageLevels, config.LogPackageLevels) {
+		for pkg := range config.LogPackageLevels {
+			if _, ok := c.LogPackageLevels[pkg]; !ok {
+				log.SetPackageLevel(pkg, "")
+			}
+		}
+		for pkg, level := range c.LogPackageLevels {
+			err := log.SetPackageLevel(pkg, level)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if c.LogDedupWindow != config.LogDedupWindow {
+		log.SetDedup(time.Duration(c.LogDedupWindow))
+	}
+	if c.LogSampleInterval != config.LogSampleInterval ||
+		c.LogSampleFirst != config.LogSampleFirst ||
+		c.LogSampleThereafter != config.LogSampleThereafter {
+		log.SetSampling(time.Duration(c.LogSampleInterval), c.LogSampleFirst, c.LogSampleThereafter)
+	}
+	if c.TraceSampleRate != config.TraceSampleRate {
+		tracing.SetSampleRate(c.TraceSampleRate)
+	}
+	config = c
+	if game != nil {
+		game = newGame
+	}
+
+	e := &Event{Config: c, Game: newGame, Changes: changes}
+	return e, append([]*chanrpc.Server(nil), servers...), nil
+}
+
+// diff appends the fields which differ to changes, or to fixedKeys for the
+// fields tagged reload:"false"
+func diff(old reflect.Value, new reflect.Value, path string, fixed bool, changes *[]Change, fixedKeys *[]string) {
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		key := path + f.Name
+		fieldFixed := fixed || f.Tag.Get("reload") == "false"
+		o := old.Field(i)
+		n := new.Field(i)
+
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) {
+			diff(o, n, key+".", fieldFixed, changes, fixedKeys)
+			continue
+		}
+		if reflect.DeepEqual(o.Interface(), n.Interface()) {
+			continue
+		}
+		if fieldFixed {
+			*fixedKeys = append(*fixedKeys, key)
+		} else {
+			*changes = append(*changes, Change{Key: key, Old: o.Interface(), New: n.Interface()})
+		}
+	}
+}
+
+// Watch reloads the config file when its modification time changes
+func Watch(interval time.Duration) {
+	mutex.Lock()
+	if closing != nil {
+		mutex.Unlock()
+		return
+	}
+	closing = make(chan bool)
+	c := closing
+	mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c:
+				return
+			case <-ticker.C:
+			}
+
+			if !modified() {
+				continue
+			}
+			e, err := Reload()
+			if err != nil {
+				log.Error("%v", err)
+				continue
+			}
+			log.Release("config reloaded: %v", formatChanges(e.Changes))
+		}
+	}()
+}
+
+func modified() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if name == "" {
+		return false
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return !fi.ModTime().Equal(modTime)
+}
+
+// stops watching the config file
+func Close() {
+	mutex.Lock()
+	if closing != nil {
+		close(closing)
+		closing = nil
+	}
+	mutex.Unlock()
+}
+
+// the keys changed, the values are not shown as they may be secrets
+func formatChanges(changes []Change) string {
+	if len(changes) == 0 {
+		return "no changes"
+	}
+
+	var s []string
+	for _, c := range changes {
+		s = append(s, c.Key)
+	}
+	return "changed " + strings.Join(s, ", ")
+}
+
+func commandReload([]string) string {
+	e, err := Reload()
+	if err != nil {
+		return strings.Replace(err.Error(), "\n", "\r\n", -1)
+	}
+	return formatChanges(e.Changes)
+}
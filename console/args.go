@@ -0,0 +1,92 @@
+package console
+
+import (
+	"errors"
+	"strings"
+)
+
+// a word of a command line, start is its offset in the line
+type token struct {
+	value string
+	start int
+}
+
+// splits a command line into words. Words are separated by spaces and tabs,
+// 'single quotes' keep everything literally, "double quotes" and the words
+// outside quotes may escape a character with a backslash
+func splitArgs(line string) ([]string, error) {
+	tokens, _, quote, escaped := tokenize(line)
+	if quote != 0 {
+		return nil, errors.New("unterminated " + string(quote) + " quote")
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+
+	args := make([]string, len(tokens))
+	for i, t := range tokens {
+		args[i] = t.value
+	}
+	return args, nil
+}
+
+// tokenize splits an unfinished command line, partial reports whether the
+// last word is still being typed, quote is the open quote if any
+func tokenize(line string) (tokens []token, partial bool, quote rune, escaped bool) {
+	var word []rune
+	inWord := false
+	start := 0
+	for i, r := range line {
+		switch {
+		case escaped:
+			word = append(word, r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word = append(word, r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escaped = true
+			} else {
+				word = append(word, r)
+			}
+		case r == ' ' || r == '\t':
+			if inWord {
+				tokens = append(tokens, token{string(word), start})
+				word = word[:0]
+				inWord = false
+			}
+			continue
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '\\':
+			escaped = true
+		default:
+			word = append(word, r)
+		}
+		if !inWord {
+			inWord = true
+			start = i
+		}
+	}
+	if inWord {
+		tokens = append(tokens, token{string(word), start})
+	}
+	return tokens, inWord, quote, escaped
+}
+
+// quotes an argument if it would not be read back as is
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t'\"\\") {
+		return arg
+	}
+	if !strings.Contains(arg, "'") {
+		return "'" + arg + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -0,0 +1,122 @@
+package console
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"strings"
+	"time"
+)
+
+// a session is closed after maxLoginFailures failed logins
+const maxLoginFailures = 3
+
+// the roles required by the commands, ConsoleCommandRoles of the settings
+// overrides them
+var roles = make(map[string]string)
+
+// RequireRole restricts a command to the users with role when a login is
+// required (ConsoleUsers of the settings is not empty)
+// you must call the function before calling console.Init
+// goroutine not safe
+func RequireRole(name string, role string) {
+	roles[name] = role
+}
+
+func commandRole(name string) string {
+	if role, ok := config.ConsoleCommandRoles[name]; ok {
+		return role
+	}
+	return roles[name]
+}
+
+func loginRequired() bool {
+	return len(config.ConsoleUsers) > 0
+}
+
+func findUser(name string, password string) *conf.ConsoleUser {
+	for i := range config.ConsoleUsers {
+		u := &conf.ConsoleUser{}
+		*u = config.ConsoleUsers[i]
+		if u.Name == name && checkPassword(u.Password, password) {
+			return u
+		}
+	}
+	return nil
+}
+
+func checkPassword(expected string, password string) bool {
+	if strings.HasPrefix(expected, "sha256:") {
+		sum := sha256.Sum256([]byte(password))
+		password = "sha256:" + hex.EncodeToString(sum[:])
+		expected = strings.ToLower(expected)
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+func hasRole(u *conf.ConsoleUser, role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// login handles login [name] password, it returns false if the session must
+// be closed
+func (a *Agent) login(args []string) bool {
+	if !loginRequired() {
+		a.conn.Write([]byte("login not required\r\n"))
+		return true
+	}
+
+	var name, password string
+	switch len(args) {
+	case 1:
+		password = args[0]
+	case 2:
+		name, password = args[0], args[1]
+	default:
+		a.conn.Write([]byte("Usage: login [name] password\r\n"))
+		return true
+	}
+
+	u := findUser(name, password)
+	if u == nil {
+		a.failures++
+		log.Release("console: login failed from %v, user %q, attempt %v",
+			a.conn.RemoteAddr(), name, a.failures)
+
+		// slows down guessing
+		time.Sleep(time.Second)
+		a.conn.Write([]byte("login failed\r\n"))
+		return a.failures < maxLoginFailures
+	}
+
+	a.user = u
+	a.failures = 0
+	log.Release("console: user %q logged in from %v", name, a.conn.RemoteAddr())
+	a.conn.Write([]byte("ok\r\n"))
+	return true
+}
+
+// whether the session may run the command, writes the reason if not
+func (a *Agent) allowed(name string) bool {
+	if !loginRequired() {
+		return true
+	}
+	if a.user == nil {
+		a.conn.Write([]byte("login required, try `login [name] password`\r\n"))
+		return false
+	}
+	if role := commandRole(name); role != "" && !hasRole(a.user, role) {
+		log.Release("console: user %q from %v denied command %v",
+			a.user.Name, a.conn.RemoteAddr(), name)
+		a.conn.Write([]byte("permission denied, " + name + " requires role " + role + "\r\n"))
+		return false
+	}
+	return true
+}
@@ -3,20 +3,38 @@ package console
 import (
 	"fmt"
 	"github.com/name5566/leaf/chanrpc"
-	"github.com/name5566/leaf/conf"
 	"github.com/name5566/leaf/log"
+	"io"
 	"os"
 	"path"
+	"runtime"
+	"runtime/debug"
 	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// the registered commands, only appended to before console.Init and read
+// without lock after
 var commands = []Command{
 	new(CommandHelp),
 	new(CommandCPUProf),
 	new(CommandProf),
+	new(CommandProfRate),
+	new(CommandTrace),
+	new(CommandLog),
+	new(CommandRuntime),
+	new(CommandMem),
 }
 
+// the version shown by the runtime command, set by leaf.Run
+var Version string
+
+var startTime = time.Now()
+
 type Command interface {
 	// must goroutine safe
 	name() string
@@ -26,6 +44,15 @@ type Command interface {
 	run(args []string) string
 }
 
+func findCommand(name string) Command {
+	for _, c := range commands {
+		if c.name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
 type ExternalCommand struct {
 	_name  string
 	_help  string
@@ -40,13 +67,8 @@ func (c *ExternalCommand) help() string {
 	return c._help
 }
 
-func (c *ExternalCommand) run(_args []string) string {
-	args := make([]interface{}, len(_args))
-	for i, v := range _args {
-		args[i] = v
-	}
-
-	ret, err := c.server.Call1(c._name, args...)
+func (c *ExternalCommand) run(args []string) string {
+	ret, err := c.call(args)
 	if err != nil {
 		return err.Error()
 	}
@@ -58,6 +80,15 @@ func (c *ExternalCommand) run(_args []string) string {
 	return output
 }
 
+// calls the handler with the arguments as strings
+func (c *ExternalCommand) call(_args []string) (interface{}, error) {
+	args := make([]interface{}, len(_args))
+	for i, v := range _args {
+		args[i] = v
+	}
+	return c.server.Call1(c._name, args...)
+}
+
 // you must call the function before calling console.Init
 // goroutine not safe
 func Register(name string, help string, f interface{}, server *chanrpc.Server) {
@@ -76,6 +107,42 @@ func Register(name string, help string, f interface{}, server *chanrpc.Server) {
 	commands = append(commands, c)
 }
 
+// a command executed on the console goroutine
+type FuncCommand struct {
+	_name string
+	_help string
+	f     func(args []string) string
+}
+
+func (c *FuncCommand) name() string {
+	return c._name
+}
+
+func (c *FuncCommand) help() string {
+	return c._help
+}
+
+func (c *FuncCommand) run(args []string) string {
+	return c.f(args)
+}
+
+// f must be goroutine safe
+// you must call the function before calling console.Init
+// goroutine not safe
+func RegisterFunc(name string, help string, f func(args []string) string) {
+	for _, c := range commands {
+		if c.name() == name {
+			log.Fatal("command %v is already registered", name)
+		}
+	}
+
+	c := new(FuncCommand)
+	c._name = name
+	c._help = help
+	c.f = f
+	commands = append(commands, c)
+}
+
 // help
 type CommandHelp struct{}
 
@@ -92,6 +159,10 @@ func (c *CommandHelp) run([]string) string {
 	for _, c := range commands {
 		output += c.name() + " - " + c.help() + "\r\n"
 	}
+	if loginRequired() {
+		output += "login - log in, usage: login [name] password\r\n"
+	}
+	output += "history - lists the commands of the session, !! or !N runs one again\r\n"
 	output += "quit - exit console"
 
 	return output
@@ -100,6 +171,18 @@ func (c *CommandHelp) run([]string) string {
 // cpuprof
 type CommandCPUProf struct{}
 
+// the running CPU profile or execution trace
+type profiling struct {
+	mutex sync.Mutex
+	file  *os.File
+	timer *time.Timer
+}
+
+var (
+	cpuProfiling   profiling
+	traceProfiling profiling
+)
+
 func (c *CommandCPUProf) name() string {
 	return "cpuprof"
 }
@@ -111,9 +194,10 @@ func (c *CommandCPUProf) help() string {
 func (c *CommandCPUProf) usage() string {
 	return "cpuprof writes runtime profiling data in the format expected by \r\n" +
 		"the pprof visualization tool\r\n\r\n" +
-		"Usage: cpuprof start|stop\r\n" +
-		"  start - enables CPU profiling\r\n" +
-		"  stop  - stops the current CPU profile"
+		"Usage: cpuprof start [duration]|stop\r\n" +
+		"  start          - enables CPU profiling\r\n" +
+		"  start duration - enables CPU profiling for a duration, e.g. 30 (seconds) or 2m\r\n" +
+		"  stop           - stops the current CPU profile"
 }
 
 func (c *CommandCPUProf) run(args []string) string {
@@ -121,30 +205,102 @@ func (c *CommandCPUProf) run(args []string) string {
 		return c.usage()
 	}
 
-	switch args[0] {
-	case "start":
-		fn := profileName() + ".cpuprof"
-		f, err := os.Create(fn)
-		if err != nil {
-			return err.Error()
-		}
-		err = pprof.StartCPUProfile(f)
-		if err != nil {
-			f.Close()
-			return err.Error()
+	switch {
+	case args[0] == "start" && len(args) <= 2:
+		var d time.Duration
+		if len(args) == 2 {
+			var err error
+			d, err = parseSeconds(args[1])
+			if err != nil {
+				return err.Error()
+			}
 		}
-		return fn
-	case "stop":
-		pprof.StopCPUProfile()
-		return ""
+		return cpuProfiling.start(profileName()+".cpuprof", d, pprof.StartCPUProfile, pprof.StopCPUProfile)
+	case args[0] == "stop" && len(args) == 1:
+		return cpuProfiling.stop(pprof.StopCPUProfile)
 	default:
 		return c.usage()
 	}
 }
 
+// starts writing to fn, and stops after d if d is not 0
+func (p *profiling) start(fn string, d time.Duration, start func(w io.Writer) error, stop func()) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.file != nil {
+		return "already running, writing " + p.file.Name()
+	}
+	f, err := os.Create(fn)
+	if err != nil {
+		return err.Error()
+	}
+	err = start(f)
+	if err != nil {
+		f.Close()
+		return err.Error()
+	}
+
+	p.file = f
+	if d > 0 {
+		p.timer = time.AfterFunc(d, func() {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			if p.file == f {
+				p.close(stop)
+				log.Release("console: %v written", fn)
+			}
+		})
+		return fn + ", stops in " + d.String()
+	}
+	return fn
+}
+
+func (p *profiling) stop(stop func()) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.file == nil {
+		return "not running"
+	}
+	fn := p.file.Name()
+	p.close(stop)
+	return fn
+}
+
+// you must hold mutex
+func (p *profiling) close(stop func()) {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	stop()
+	p.file.Close()
+	p.file = nil
+}
+
+// parses a number of seconds or a duration, e.g. 30 or 2m
+func parseSeconds(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		s = strconv.Itoa(n) + "s"
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration: %v", s)
+	}
+	return d, nil
+}
+
+func (c *CommandCPUProf) complete(args []string) []string {
+	if len(args) == 0 {
+		return []string{"start", "stop"}
+	}
+	return nil
+}
+
 func profileName() string {
 	now := time.Now()
-	return path.Join(conf.ProfilePath,
+	return path.Join(config.ProfilePath,
 		fmt.Sprintf("%d%02d%02d_%02d_%02d_%02d",
 			now.Year(),
 			now.Month(),
@@ -168,11 +324,13 @@ func (c *CommandProf) help() string {
 func (c *CommandProf) usage() string {
 	return "prof writes runtime profiling data in the format expected by \r\n" +
 		"the pprof visualization tool\r\n\r\n" +
-		"Usage: prof goroutine|heap|thread|block\r\n" +
+		"Usage: prof goroutine|heap|thread|block|mutex\r\n" +
 		"  goroutine - stack traces of all current goroutines\r\n" +
 		"  heap      - a sampling of all heap allocations\r\n" +
 		"  thread    - stack traces that led to the creation of new OS threads\r\n" +
-		"  block     - stack traces that led to blocking on synchronization primitives"
+		"  block     - stack traces that led to blocking on synchronization primitives\r\n" +
+		"  mutex     - stack traces of holders of contended mutexes\r\n\r\n" +
+		"The block and mutex profiles are empty unless enabled by profrate"
 }
 
 func (c *CommandProf) run(args []string) string {
@@ -197,6 +355,9 @@ func (c *CommandProf) run(args []string) string {
 	case "block":
 		p = pprof.Lookup("block")
 		fn = profileName() + ".bprof"
+	case "mutex":
+		p = pprof.Lookup("mutex")
+		fn = profileName() + ".mprof"
 	default:
 		return c.usage()
 	}
@@ -213,3 +374,281 @@ func (c *CommandProf) run(args []string) string {
 
 	return fn
 }
+
+func (c *CommandProf) complete(args []string) []string {
+	if len(args) == 0 {
+		return []string{"goroutine", "heap", "thread", "block", "mutex"}
+	}
+	return nil
+}
+
+// log
+type CommandLog struct{}
+
+func (c *CommandLog) name() string {
+	return "log"
+}
+
+func (c *CommandLog) help() string {
+	return "shows or changes the log levels"
+}
+
+func (c *CommandLog) usage() string {
+	return "log shows or changes the log level and the levels of packages\r\n\r\n" +
+		"Usage: log level|package\r\n" +
+		"  level                 - shows the level and the package levels\r\n" +
+		"  level LEVEL           - sets the level (trace, debug, release, error or fatal)\r\n" +
+		"  package PKG LEVEL     - sets the level of a package, e.g. package gate debug\r\n" +
+		"  package PKG reset     - removes the level of a package"
+}
+
+func (c *CommandLog) run(args []string) string {
+	if len(args) == 0 {
+		return c.usage()
+	}
+
+	switch {
+	case args[0] == "level" && len(args) == 1:
+		output := "level: " + log.Level()
+		levels := log.PackageLevels()
+		pkgs := make([]string, 0, len(levels))
+		for pkg := range levels {
+			pkgs = append(pkgs, pkg)
+		}
+		sort.Strings(pkgs)
+		for _, pkg := range pkgs {
+			output += "\r\n" + pkg + ": " + levels[pkg]
+		}
+		return output
+	case args[0] == "level" && len(args) == 2:
+		err := log.SetLevel(args[1])
+		if err != nil {
+			return err.Error()
+		}
+		return "ok"
+	case args[0] == "package" && len(args) == 3:
+		level := args[2]
+		if level == "reset" {
+			level = ""
+		}
+		err := log.SetPackageLevel(args[1], level)
+		if err != nil {
+			return err.Error()
+		}
+		return "ok"
+	default:
+		return c.usage()
+	}
+}
+
+func (c *CommandLog) complete(args []string) []string {
+	levels := []string{"trace", "debug", "release", "error", "fatal"}
+	switch {
+	case len(args) == 0:
+		return []string{"level", "package"}
+	case len(args) == 1 && args[0] == "level":
+		return levels
+	case len(args) == 1 && args[0] == "package":
+		var pkgs []string
+		for pkg := range log.PackageLevels() {
+			pkgs = append(pkgs, pkg)
+		}
+		return pkgs
+	case len(args) == 2 && args[0] == "package":
+		return append(levels, "reset")
+	default:
+		return nil
+	}
+}
+
+// runtime
+type CommandRuntime struct{}
+
+func (c *CommandRuntime) name() string {
+	return "runtime"
+}
+
+func (c *CommandRuntime) help() string {
+	return "version, uptime and goroutines"
+}
+
+func (c *CommandRuntime) run([]string) string {
+	uptime := time.Since(startTime).Truncate(time.Second)
+	return "version: " + Version + "\r\n" +
+		"go version: " + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH + "\r\n" +
+		"started: " + startTime.Format("2006-01-02 15:04:05") + "\r\n" +
+		"uptime: " + uptime.String() + "\r\n" +
+		"goroutines: " + strconv.Itoa(runtime.NumGoroutine()) + "\r\n" +
+		"GOMAXPROCS: " + strconv.Itoa(runtime.GOMAXPROCS(0)) + "\r\n" +
+		"CPUs: " + strconv.Itoa(runtime.NumCPU())
+}
+
+// mem
+type CommandMem struct{}
+
+func (c *CommandMem) name() string {
+	return "mem"
+}
+
+func (c *CommandMem) help() string {
+	return "memory and GC statistics"
+}
+
+func (c *CommandMem) usage() string {
+	return "mem shows the memory and GC statistics\r\n\r\n" +
+		"Usage: mem [gc|free]\r\n" +
+		"  gc   - runs a garbage collection first\r\n" +
+		"  free - returns as much memory as possible to the OS first"
+}
+
+func (c *CommandMem) complete(args []string) []string {
+	if len(args) == 0 {
+		return []string{"gc", "free"}
+	}
+	return nil
+}
+
+func (c *CommandMem) run(args []string) string {
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "gc":
+		runtime.GC()
+	case len(args) == 1 && args[0] == "free":
+		debug.FreeOSMemory()
+	default:
+		return c.usage()
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	output := "heap alloc: " + bytesString(m.HeapAlloc) + ", objects: " + strconv.FormatUint(m.HeapObjects, 10) + "\r\n" +
+		"heap in use: " + bytesString(m.HeapInuse) + ", idle: " + bytesString(m.HeapIdle) +
+		", released: " + bytesString(m.HeapReleased) + "\r\n" +
+		"stack in use: " + bytesString(m.StackInuse) + "\r\n" +
+		"total alloc: " + bytesString(m.TotalAlloc) + ", mallocs: " + strconv.FormatUint(m.Mallocs, 10) +
+		", frees: " + strconv.FormatUint(m.Frees, 10) + "\r\n" +
+		"sys: " + bytesString(m.Sys) + "\r\n" +
+		"GC: " + strconv.FormatUint(uint64(m.NumGC), 10) + " cycles, next at " + bytesString(m.NextGC) +
+		", pause total: " + time.Duration(m.PauseTotalNs).String() +
+		", CPU fraction: " + strconv.FormatFloat(m.GCCPUFraction*100, 'f', 2, 64) + "%"
+	if m.NumGC > 0 {
+		output += "\r\nlast GC: " + time.Unix(0, int64(m.LastGC)).Format("2006-01-02 15:04:05") +
+			", pause: " + time.Duration(m.PauseNs[(m.NumGC+255)%256]).String()
+	}
+	return output
+}
+
+func bytesString(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return strconv.FormatUint(b, 10) + " B"
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// profrate
+type CommandProfRate struct{}
+
+// the block profile rate cannot be read from the runtime
+var (
+	blockProfileRate      int
+	mutexBlockProfileRate sync.Mutex
+)
+
+func (c *CommandProfRate) name() string {
+	return "profrate"
+}
+
+func (c *CommandProfRate) help() string {
+	return "shows or sets the block and mutex profile rates"
+}
+
+func (c *CommandProfRate) usage() string {
+	return "profrate shows or sets the rates of the block and mutex profiles\r\n\r\n" +
+		"Usage: profrate [block|mutex RATE]\r\n" +
+		"  block RATE - samples a blocking event per RATE nanoseconds blocked,\r\n" +
+		"               1 samples every event, 0 disables the profile\r\n" +
+		"  mutex RATE - samples 1 in RATE mutex contention events,\r\n" +
+		"               0 disables the profile"
+}
+
+func (c *CommandProfRate) complete(args []string) []string {
+	if len(args) == 0 {
+		return []string{"block", "mutex"}
+	}
+	return nil
+}
+
+func (c *CommandProfRate) run(args []string) string {
+	mutexBlockProfileRate.Lock()
+	defer mutexBlockProfileRate.Unlock()
+
+	switch len(args) {
+	case 0:
+		return "block: " + strconv.Itoa(blockProfileRate) + "\r\n" +
+			"mutex: " + strconv.Itoa(runtime.SetMutexProfileFraction(-1))
+	case 2:
+		rate, err := strconv.Atoi(args[1])
+		if err != nil || rate < 0 {
+			return "invalid rate: " + args[1]
+		}
+		switch args[0] {
+		case "block":
+			runtime.SetBlockProfileRate(rate)
+			blockProfileRate = rate
+		case "mutex":
+			runtime.SetMutexProfileFraction(rate)
+		default:
+			return c.usage()
+		}
+		return "ok"
+	default:
+		return c.usage()
+	}
+}
+
+// trace
+type CommandTrace struct{}
+
+func (c *CommandTrace) name() string {
+	return "trace"
+}
+
+func (c *CommandTrace) help() string {
+	return "captures an execution trace"
+}
+
+func (c *CommandTrace) usage() string {
+	return "trace writes an execution trace for the go tool trace command\r\n\r\n" +
+		"Usage: trace duration|stop\r\n" +
+		"  duration - traces for a duration, e.g. 5 (seconds) or 500ms\r\n" +
+		"  stop     - stops the current trace"
+}
+
+func (c *CommandTrace) complete(args []string) []string {
+	if len(args) == 0 {
+		return []string{"stop"}
+	}
+	return nil
+}
+
+func (c *CommandTrace) run(args []string) string {
+	if len(args) != 1 {
+		return c.usage()
+	}
+	if args[0] == "stop" {
+		return traceProfiling.stop(trace.Stop)
+	}
+
+	d, err := parseSeconds(args[0])
+	if err != nil {
+		return err.Error()
+	}
+	return traceProfiling.start(profileName()+".trace", d, trace.Start, trace.Stop)
+}
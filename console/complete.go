@@ -0,0 +1,80 @@
+package console
+
+import (
+	"sort"
+	"strings"
+)
+
+// a command may implement completer to complete its arguments
+type completer interface {
+	// the candidates for the argument following args
+	complete(args []string) []string
+}
+
+var completers = make(map[string]func(args []string) []string)
+
+// SetCompleter sets the tab completion of the arguments of a command, f
+// returns the candidates for the argument following args
+// f must be goroutine safe
+// you must call the function before calling console.Init
+// goroutine not safe
+func SetCompleter(name string, f func(args []string) []string) {
+	completers[name] = f
+}
+
+// the commands handled by the session
+var sessionCommands = []string{"history", "login", "quit"}
+
+// the candidates for the word typed at the end of line, and the offset of
+// the word in line
+func completeLine(line string) (candidates []string, start int) {
+	tokens, partial, _, _ := tokenize(line)
+	prefix := ""
+	start = len(line)
+	if partial {
+		last := tokens[len(tokens)-1]
+		prefix = last.value
+		start = last.start
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	var all []string
+	if len(tokens) == 0 {
+		for _, c := range commands {
+			all = append(all, c.name())
+		}
+		all = append(all, sessionCommands...)
+	} else {
+		args := make([]string, len(tokens)-1)
+		for i, t := range tokens[1:] {
+			args[i] = t.value
+		}
+		if f, ok := completers[tokens[0].value]; ok {
+			all = f(args)
+		} else if c, ok := findCommand(tokens[0].value).(completer); ok {
+			all = c.complete(args)
+		}
+	}
+
+	for _, s := range all {
+		if strings.HasPrefix(s, prefix) {
+			candidates = append(candidates, s)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates, start
+}
+
+func commonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	prefix := candidates[0]
+	for _, s := range candidates[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	// a candidate may differ from another in the middle of a character
+	return strings.ToValidUTF8(prefix, "")
+}
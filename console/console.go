@@ -1,78 +1,142 @@
 package console
 
 import (
-	"bufio"
+	"crypto/tls"
 	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
 	"github.com/name5566/leaf/network"
 	"math"
+	"net"
 	"strconv"
-	"strings"
 )
 
-var server *network.TCPServer
+var (
+	server *network.TCPServer
+	// the settings given to InitConfig, not changed after
+	config = new(conf.Config)
+)
 
+// Init starts the console with the settings of the conf variables
 func Init() {
-	if conf.ConsolePort == 0 {
+	InitConfig(conf.Default())
+}
+
+// InitConfig starts the console with the console settings of c, c must not
+// be changed after
+func InitConfig(c *conf.Config) {
+	config = c
+	if c.ConsolePort == 0 && c.ConsoleHTTPPort == 0 {
 		return
 	}
 
-	server = new(network.TCPServer)
-	server.Addr = "localhost:" + strconv.Itoa(conf.ConsolePort)
-	server.MaxConnNum = int(math.MaxInt32)
-	server.PendingWriteNum = 100
-	server.NewAgent = newAgent
+	host := c.ConsoleAddr
+	if host == "" {
+		host = "localhost"
+	}
+	if len(c.ConsoleUsers) == 0 && !isLoopback(host) {
+		log.Release("console: listening on %v without users, anyone may run commands", host)
+	}
+	var tlsConfig *tls.Config
+	if c.ConsoleTLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ConsoleTLSCert, c.ConsoleTLSKey)
+		if err != nil {
+			log.Fatal("%v", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
 
-	server.Start()
+	if c.ConsolePort != 0 {
+		server = new(network.TCPServer)
+		server.Addr = net.JoinHostPort(host, strconv.Itoa(c.ConsolePort))
+		server.TLSConfig = tlsConfig
+		server.MaxConnNum = int(math.MaxInt32)
+		server.PendingWriteNum = 100
+		server.NewAgent = newAgent
+
+		server.Start()
+	}
+	if c.ConsoleHTTPPort != 0 {
+		startHTTP(net.JoinHostPort(host, strconv.Itoa(c.ConsoleHTTPPort)), tlsConfig)
+	}
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
 func Destroy() {
 	if server != nil {
 		server.Close()
 	}
+	closeHTTP()
 }
 
 type Agent struct {
-	conn   *network.TCPConn
-	reader *bufio.Reader
+	conn     *network.TCPConn
+	reader   *lineReader
+	user     *conf.ConsoleUser
+	failures int
 }
 
 func newAgent(conn *network.TCPConn) network.Agent {
 	a := new(Agent)
 	a.conn = conn
-	a.reader = bufio.NewReader(conn)
+	a.reader = newLineReader(conn, conn.Write)
 	return a
 }
 
 func (a *Agent) Run() {
+	a.reader.negotiate()
 	for {
-		if conf.ConsolePrompt != "" {
-			a.conn.Write([]byte(conf.ConsolePrompt))
+		line, err := a.reader.readLine(config.ConsolePrompt)
+		if err == errInterrupt {
+			continue
 		}
-
-		line, err := a.reader.ReadString('\n')
 		if err != nil {
 			break
 		}
-		line = strings.TrimSuffix(line[:len(line)-1], "\r")
 
-		args := strings.Fields(line)
+		args, err := splitArgs(line)
+		if err != nil {
+			a.conn.Write([]byte(err.Error() + "\r\n"))
+			continue
+		}
 		if len(args) == 0 {
 			continue
 		}
 		if args[0] == "quit" {
 			break
 		}
-		var c Command
-		for _, _c := range commands {
-			if _c.name() == args[0] {
-				c = _c
+		if args[0] == "login" {
+			if !a.login(args[1:]) {
 				break
 			}
+			continue
+		}
+		if args[0] == "history" {
+			if output := a.reader.listHistory(); output != "" {
+				a.conn.Write([]byte(output + "\r\n"))
+			}
+			continue
 		}
+		c := findCommand(args[0])
 		if c == nil {
 			a.conn.Write([]byte("command not found, try `help` for help\r\n"))
 			continue
 		}
+		if c.name() != "help" && !a.allowed(c.name()) {
+			continue
+		}
+		if sc, ok := c.(streamer); ok {
+			if !a.runStream(sc, args[1:]) {
+				break
+			}
+			continue
+		}
 		output := c.run(args[1:])
 		if output != "" {
 			a.conn.Write([]byte(output + "\r\n"))
@@ -80,4 +144,6 @@ func (a *Agent) Run() {
 	}
 }
 
-func (a *Agent) OnClose() {}
+func (a *Agent) OnClose() {
+	a.reader.close()
+}
@@ -0,0 +1,186 @@
+package console_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/console"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginNotInHistory(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	savedPort, savedUsers := conf.ConsolePort, conf.ConsoleUsers
+	conf.ConsolePort = port
+	conf.ConsoleUsers = []conf.ConsoleUser{{Name: "admin", Password: "secret"}}
+	defer func() { conf.ConsolePort, conf.ConsoleUsers = savedPort, savedUsers }()
+	console.Init()
+	defer console.Destroy()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	conn.Write([]byte("login admin secret\r\nhistory\r\nquit\r\n"))
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(data)
+	if !strings.Contains(output, "   1  history") {
+		t.Fatalf("history not listed: %q", output)
+	}
+	if strings.Contains(output, "secret") {
+		t.Fatalf("password in history: %q", output)
+	}
+}
+
+func TestHTTPArgs(t *testing.T) {
+	// echo fails unless every argument is a string
+	server := chanrpc.NewServer(10)
+	console.Register("echo", "echo args", func(args []interface{}) interface{} {
+		var ss []string
+		for _, arg := range args {
+			ss = append(ss, arg.(string))
+		}
+		return strings.Join(ss, " ")
+	}, server)
+	go func() {
+		for ci := range server.ChanCall {
+			server.Exec(ci)
+		}
+	}()
+	defer server.Close()
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	savedPort := conf.ConsoleHTTPPort
+	conf.ConsoleHTTPPort = port
+	defer func() { conf.ConsoleHTTPPort = savedPort }()
+	console.Init()
+	defer console.Destroy()
+
+	url := fmt.Sprintf("http://localhost:%v/commands/echo", port)
+	resp, err := http.Post(url, "application/json",
+		strings.NewReader(`{"args": ["a", 1, 2.5, true, {"b": null}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var ret struct {
+		Result string `json:"result"`
+		Error  string `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %v: %v", resp.StatusCode, ret.Error)
+	}
+	if ret.Result != `a 1 2.5 true {"b":null}` {
+		t.Fatalf("result %q", ret.Result)
+	}
+}
+
+func TestLoginNotEchoed(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	savedPort, savedUsers := conf.ConsolePort, conf.ConsoleUsers
+	conf.ConsolePort = port
+	conf.ConsoleUsers = []conf.ConsoleUser{{Name: "admin", Password: "secret"}}
+	defer func() { conf.ConsolePort, conf.ConsoleUsers = savedPort, savedUsers }()
+	console.Init()
+	defer console.Destroy()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// IAC DO ECHO switches the session to character mode, the server echoes
+	conn.Write([]byte{255, 253, 1})
+	conn.Write([]byte("login admin secret\rquit\r"))
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(data)
+	if !strings.Contains(output, "ok\r\n") {
+		t.Fatalf("login failed: %q", output)
+	}
+	if strings.Contains(output, "secret") {
+		t.Fatalf("password echoed: %q", output)
+	}
+}
+
+func TestSessionEndsWithInput(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	savedPort := conf.ConsolePort
+	conf.ConsolePort = port
+	defer func() { conf.ConsolePort = savedPort }()
+	console.Init()
+	defer console.Destroy()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// the input typed after quit is never read, the connection stays open
+	conn.Write([]byte("quit\r\n"))
+	conn.Write([]byte(strings.Repeat("help\r\n", 1000)))
+	// closed by the server, reset as the input is left
+	ioutil.ReadAll(conn)
+
+	// the goroutine reading the input ends with the session
+	buf := make([]byte, 1<<20)
+	for i := 0; ; i++ {
+		stacks := string(buf[:runtime.Stack(buf, true)])
+		if !strings.Contains(stacks, "lineReader).pump") {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("input goroutine leaked:\n%v", stacks)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,195 @@
+package console
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// the HTTP/JSON admin API:
+//
+//	GET  /commands          lists the commands: [{"name": ..., "help": ...}]
+//	POST /commands/NAME     runs a command with {"args": [...]} and returns
+//	                        {"result": ...}, or {"error": ...} on failure
+//
+// the commands registered by RegisterStream and RegisterExternalStream write
+// a JSON object {"line": ...} per line of output instead, and are cancelled
+// when the client goes away.
+// String arguments are passed as is and other JSON values as JSON text, the
+// commands get strings as they do from the console. A login
+// is required (HTTP basic authentication, or a bearer token for a user
+// without name) if there are ConsoleUsers in the settings
+var httpServer *http.Server
+
+type commandInfo struct {
+	Name string `json:"name"`
+	Help string `json:"help"`
+}
+
+type commandRequest struct {
+	Args []interface{} `json:"args"`
+}
+
+type commandResponse struct {
+	Result interface{} `json:"result"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func startHTTP(addr string, tlsConfig *tls.Config) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/commands", handleCommands)
+	mux.HandleFunc("/commands/", handleCommand)
+
+	// no write timeout, the streaming commands write while they run
+	httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	go func() {
+		err := httpServer.Serve(ln)
+		if err != http.ErrServerClosed {
+			log.Error("console: HTTP server error: %v", err)
+		}
+	}()
+}
+
+func closeHTTP() {
+	if httpServer != nil {
+		httpServer.Close()
+	}
+}
+
+func handleCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	if _, ok := authenticate(w, r); !ok {
+		return
+	}
+
+	infos := make([]commandInfo, 0, len(commands))
+	for _, c := range commands {
+		infos = append(infos, commandInfo{c.name(), c.help()})
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func handleCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	u, ok := authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/commands/")
+	c := findCommand(name)
+	if c == nil {
+		writeError(w, http.StatusNotFound, "command not found: "+name)
+		return
+	}
+	if u != nil {
+		if role := commandRole(name); role != "" && !hasRole(u, role) {
+			log.Release("console: user %q from %v denied command %v", u.Name, r.RemoteAddr, name)
+			writeError(w, http.StatusForbidden, "permission denied, "+name+" requires role "+role)
+			return
+		}
+	}
+
+	var req commandRequest
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+			return
+		}
+	}
+
+	args := make([]string, len(req.Args))
+	for i, arg := range req.Args {
+		if s, ok := arg.(string); ok {
+			args[i] = s
+		} else {
+			data, _ := json.Marshal(arg)
+			args[i] = string(data)
+		}
+	}
+	if ec, ok := c.(*ExternalCommand); ok {
+		ret, err := ec.call(args)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, commandResponse{Result: ret})
+		return
+	}
+	if sc, ok := c.(streamer); ok {
+		serveStream(sc, w, r, args)
+		return
+	}
+	writeJSON(w, http.StatusOK, commandResponse{Result: c.run(args)})
+}
+
+// returns the user logged in (nil if no login is required), or writes the
+// reason and returns false
+func authenticate(w http.ResponseWriter, r *http.Request) (*conf.ConsoleUser, bool) {
+	if !loginRequired() {
+		return nil, true
+	}
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") {
+			name, password, ok = "", strings.TrimPrefix(auth, "Bearer "), true
+		}
+	}
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="leaf console"`)
+		writeError(w, http.StatusUnauthorized, "login required")
+		return nil, false
+	}
+
+	u := findUser(name, password)
+	if u == nil {
+		log.Release("console: login failed from %v, user %q", r.RemoteAddr, name)
+
+		// slows down guessing
+		time.Sleep(time.Second)
+		w.Header().Set("WWW-Authenticate", `Basic realm="leaf console"`)
+		writeError(w, http.StatusUnauthorized, "login failed")
+		return nil, false
+	}
+	return u, true
+}
+
+func writeError(w http.ResponseWriter, status int, err string) {
+	writeJSON(w, status, errorResponse{err})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
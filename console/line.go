@@ -0,0 +1,595 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// telnet commands and options, RFC 854, 857 and 858
+const (
+	telnetSE   = 240
+	telnetIP   = 244
+	telnetSB   = 250
+	telnetWill = 251
+	telnetWont = 252
+	telnetDo   = 253
+	telnetDont = 254
+	telnetIAC  = 255
+
+	telnetEcho = 1
+	telnetSGA  = 3
+)
+
+const maxHistory = 100
+
+var (
+	// errInterrupt is returned by readLine on Ctrl-C
+	errInterrupt = errors.New("interrupt")
+	errStopped   = errors.New("stopped")
+)
+
+// lineReader reads command lines with history and tab completion. A telnet
+// client accepting the server echo is switched to character mode and gets
+// line editing, other clients (e.g. netcat) send lines edited by their
+// terminal
+type lineReader struct {
+	// the input is read on its own goroutine, so that a session may wait
+	// for the input and for a command at once
+	chanData chan []byte
+	closeSig chan struct{}
+	err      error
+	data     []byte
+	off      int
+	stop     <-chan struct{}
+
+	write    func(b []byte)
+	charMode bool
+	skipLF   bool
+	history  []string
+
+	// the line being edited in character mode
+	prompt  string
+	buf     []rune
+	pos     int
+	histPos int
+	draft   []rune
+}
+
+func newLineReader(r io.Reader, write func(b []byte)) *lineReader {
+	lr := new(lineReader)
+	lr.chanData = make(chan []byte)
+	lr.closeSig = make(chan struct{})
+	lr.write = write
+	go lr.pump(r)
+	return lr
+}
+
+func (lr *lineReader) pump(r io.Reader) {
+	for {
+		buf := make([]byte, 1024)
+		n, err := r.Read(buf)
+		if n > 0 {
+			select {
+			case lr.chanData <- buf[:n]:
+			case <-lr.closeSig:
+				// the input left is not read
+				return
+			}
+		}
+		if err != nil {
+			lr.err = err
+			close(lr.chanData)
+			return
+		}
+	}
+}
+
+// stops the goroutine reading the input, you must call the function once the
+// session ends
+func (lr *lineReader) close() {
+	close(lr.closeSig)
+}
+
+// reads a byte of the input, returns errStopped if stop is closed first
+func (lr *lineReader) rawByte() (byte, error) {
+	for lr.off == len(lr.data) {
+		select {
+		case data, ok := <-lr.chanData:
+			if !ok {
+				return 0, lr.err
+			}
+			lr.data = data
+			lr.off = 0
+		case <-lr.stop:
+			return 0, errStopped
+		}
+	}
+	b := lr.data[lr.off]
+	lr.off++
+	return b, nil
+}
+
+// you must call the function right after reading a byte
+func (lr *lineReader) unreadByte() {
+	lr.off--
+}
+
+// asks a telnet client to switch to character mode. The sequence is followed
+// by a carriage return and an erase of the line, so that a terminal not
+// speaking telnet does not show it
+func (lr *lineReader) negotiate() {
+	lr.write([]byte{
+		telnetIAC, telnetWill, telnetEcho,
+		telnetIAC, telnetWill, telnetSGA,
+		'\r', 0x1b, '[', 'K',
+	})
+}
+
+// reads a byte, handling the telnet commands
+func (lr *lineReader) readByte() (byte, error) {
+	for {
+		b, err := lr.rawByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != telnetIAC {
+			return b, nil
+		}
+
+		cmd, err := lr.rawByte()
+		if err != nil {
+			return 0, err
+		}
+		switch cmd {
+		case telnetIAC:
+			return telnetIAC, nil
+		case telnetIP:
+			return 3, nil
+		case telnetSB:
+			// skips the subnegotiation
+			for {
+				b, err := lr.rawByte()
+				if err != nil {
+					return 0, err
+				}
+				if b == telnetIAC {
+					b, err = lr.rawByte()
+					if err != nil {
+						return 0, err
+					}
+					if b == telnetSE {
+						break
+					}
+				}
+			}
+		case telnetWill, telnetWont, telnetDo, telnetDont:
+			opt, err := lr.rawByte()
+			if err != nil {
+				return 0, err
+			}
+			lr.option(cmd, opt)
+		}
+	}
+}
+
+func (lr *lineReader) option(cmd byte, opt byte) {
+	switch cmd {
+	case telnetDo:
+		if opt == telnetEcho {
+			lr.charMode = true
+		} else if opt != telnetSGA {
+			lr.write([]byte{telnetIAC, telnetWont, opt})
+		}
+	case telnetDont:
+		if opt == telnetEcho {
+			lr.charMode = false
+		}
+	case telnetWill:
+		if opt != telnetSGA {
+			lr.write([]byte{telnetIAC, telnetDont, opt})
+		}
+	}
+}
+
+// readLine writes the prompt and returns the next line, with the history
+// expanded (!!, !N or !prefix). It returns errInterrupt on Ctrl-C and io.EOF
+// on Ctrl-D on an empty line
+func (lr *lineReader) readLine(prompt string) (string, error) {
+	for {
+		if prompt != "" {
+			lr.write([]byte(prompt))
+		}
+
+		var line string
+		var err error
+		if lr.charMode {
+			line, err = lr.editLine(prompt)
+		} else {
+			line, err = lr.readRawLine(prompt)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if !lr.charMode && strings.Contains(line, "\t") {
+			// the terminal sends the tab with the line
+			lr.listCompletions(line[:strings.Index(line, "\t")])
+			continue
+		}
+
+		line, err = lr.expand(line)
+		if err != nil {
+			lr.write([]byte(err.Error() + "\r\n"))
+			continue
+		}
+		lr.addHistory(line)
+		return line, nil
+	}
+}
+
+func (lr *lineReader) readRawLine(prompt string) (string, error) {
+	var line []byte
+	for {
+		b, err := lr.readByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		line = append(line, b)
+
+		// the client may have switched to character mode after the prompt
+		if lr.charMode && len(line) == 1 {
+			lr.unreadByte()
+			return lr.editLine(prompt)
+		}
+	}
+}
+
+// editLine edits a line in character mode, the prompt is already written
+func (lr *lineReader) editLine(prompt string) (string, error) {
+	lr.prompt = prompt
+	lr.buf = lr.buf[:0]
+	lr.pos = 0
+	lr.histPos = len(lr.history)
+	lr.draft = nil
+
+	for {
+		b, err := lr.readByte()
+		if err != nil {
+			return "", err
+		}
+
+		// the client sends CR LF or CR NUL
+		if lr.skipLF {
+			lr.skipLF = false
+			if b == '\n' || b == 0 {
+				continue
+			}
+		}
+
+		switch b {
+		case '\r', '\n':
+			lr.skipLF = b == '\r'
+			lr.write([]byte("\r\n"))
+			return string(lr.buf), nil
+		case 1: // Ctrl-A
+			lr.pos = 0
+		case 2: // Ctrl-B
+			if lr.pos > 0 {
+				lr.pos--
+			}
+		case 3: // Ctrl-C
+			lr.write([]byte("^C\r\n"))
+			return "", errInterrupt
+		case 4: // Ctrl-D
+			if len(lr.buf) == 0 {
+				lr.write([]byte("\r\n"))
+				return "", io.EOF
+			}
+			lr.delete(lr.pos, lr.pos+1)
+		case 5: // Ctrl-E
+			lr.pos = len(lr.buf)
+		case 6: // Ctrl-F
+			if lr.pos < len(lr.buf) {
+				lr.pos++
+			}
+		case '\t':
+			lr.completeBuf()
+		case 11: // Ctrl-K
+			lr.delete(lr.pos, len(lr.buf))
+		case 12: // Ctrl-L
+			lr.write([]byte("\x1b[H\x1b[2J"))
+		case 14: // Ctrl-N
+			lr.historyNext()
+		case 16: // Ctrl-P
+			lr.historyPrev()
+		case 21: // Ctrl-U
+			lr.delete(0, lr.pos)
+		case 23: // Ctrl-W
+			i := lr.pos
+			for i > 0 && unicode.IsSpace(lr.buf[i-1]) {
+				i--
+			}
+			for i > 0 && !unicode.IsSpace(lr.buf[i-1]) {
+				i--
+			}
+			lr.delete(i, lr.pos)
+		case 8, 127: // Backspace
+			if lr.pos > 0 {
+				lr.delete(lr.pos-1, lr.pos)
+			}
+		case 0x1b:
+			lr.escape()
+		default:
+			if b < 0x20 {
+				continue
+			}
+			r := rune(b)
+			if b >= utf8.RuneSelf {
+				p := []byte{b}
+				for !utf8.FullRune(p) {
+					b, err = lr.readByte()
+					if err != nil {
+						return "", err
+					}
+					p = append(p, b)
+				}
+				r, _ = utf8.DecodeRune(p)
+			}
+			lr.buf = append(lr.buf, 0)
+			copy(lr.buf[lr.pos+1:], lr.buf[lr.pos:])
+			lr.buf[lr.pos] = r
+			lr.pos++
+		}
+		lr.refresh()
+	}
+}
+
+// handles the escape sequences of the arrow, home, end and delete keys
+func (lr *lineReader) escape() {
+	b, err := lr.readByte()
+	if err != nil || b != '[' && b != 'O' {
+		return
+	}
+	var param []byte
+	for {
+		b, err = lr.readByte()
+		if err != nil {
+			return
+		}
+		if b < '0' || b > '9' {
+			break
+		}
+		param = append(param, b)
+	}
+
+	switch b {
+	case 'A':
+		lr.historyPrev()
+	case 'B':
+		lr.historyNext()
+	case 'C':
+		if lr.pos < len(lr.buf) {
+			lr.pos++
+		}
+	case 'D':
+		if lr.pos > 0 {
+			lr.pos--
+		}
+	case 'H':
+		lr.pos = 0
+	case 'F':
+		lr.pos = len(lr.buf)
+	case '~':
+		switch string(param) {
+		case "1", "7":
+			lr.pos = 0
+		case "4", "8":
+			lr.pos = len(lr.buf)
+		case "3":
+			lr.delete(lr.pos, lr.pos+1)
+		}
+	}
+}
+
+func (lr *lineReader) delete(from int, to int) {
+	if to > len(lr.buf) {
+		to = len(lr.buf)
+	}
+	if from >= to {
+		return
+	}
+	lr.buf = append(lr.buf[:from], lr.buf[to:]...)
+	lr.pos = from
+}
+
+// redraws the line and moves the cursor
+func (lr *lineReader) refresh() {
+	shown := lr.shown()
+	s := "\r" + lr.prompt + string(lr.buf[:shown]) + "\x1b[K"
+	if n := shown - lr.pos; n > 0 {
+		s += fmt.Sprintf("\x1b[%dD", n)
+	}
+	lr.write([]byte(s))
+}
+
+// the number of runes of the line echoed, the arguments of login (the name
+// and the password) are not
+func (lr *lineReader) shown() int {
+	line := string(lr.buf)
+	tokens, _, _, _ := tokenize(line)
+	if len(tokens) < 2 || tokens[0].value != "login" {
+		return len(lr.buf)
+	}
+	return utf8.RuneCountInString(line[:tokens[1].start])
+}
+
+func (lr *lineReader) historyPrev() {
+	if lr.histPos == 0 {
+		return
+	}
+	if lr.histPos == len(lr.history) {
+		lr.draft = append([]rune(nil), lr.buf...)
+	}
+	lr.histPos--
+	lr.buf = []rune(lr.history[lr.histPos])
+	lr.pos = len(lr.buf)
+}
+
+func (lr *lineReader) historyNext() {
+	if lr.histPos == len(lr.history) {
+		return
+	}
+	lr.histPos++
+	if lr.histPos == len(lr.history) {
+		lr.buf = lr.draft
+	} else {
+		lr.buf = []rune(lr.history[lr.histPos])
+	}
+	lr.pos = len(lr.buf)
+}
+
+// completes the word before the cursor, or lists the candidates if it
+// cannot be completed further
+func (lr *lineReader) completeBuf() {
+	before := string(lr.buf[:lr.pos])
+	candidates, start := completeLine(before)
+	if len(candidates) == 0 {
+		return
+	}
+
+	var word string
+	if len(candidates) == 1 {
+		word = quoteArg(candidates[0]) + " "
+	} else {
+		prefix := commonPrefix(candidates)
+		tokens, partial, _, _ := tokenize(before)
+		if partial && prefix == tokens[len(tokens)-1].value || !partial && prefix == "" {
+			lr.write([]byte("\r\n" + strings.Join(candidates, "  ") + "\r\n"))
+			return
+		}
+		word = quoteArg(prefix)
+		if word != prefix {
+			// keeps the quote open to go on typing the word
+			word = word[:len(word)-1]
+		}
+	}
+
+	completed := []rune(before[:start] + word)
+	lr.buf = append(completed, lr.buf[lr.pos:]...)
+	lr.pos = len(completed)
+}
+
+// lists the lines completing line, for the clients without character mode
+func (lr *lineReader) listCompletions(line string) {
+	candidates, start := completeLine(line)
+	if len(candidates) == 0 {
+		lr.write([]byte("no completion\r\n"))
+		return
+	}
+	var output string
+	for _, s := range candidates {
+		output += line[:start] + quoteArg(s) + "\r\n"
+	}
+	lr.write([]byte(output))
+}
+
+// expands !!, !N and !prefix with the history
+func (lr *lineReader) expand(line string) (string, error) {
+	s := strings.TrimSpace(line)
+	if !strings.HasPrefix(s, "!") || len(s) == 1 {
+		return line, nil
+	}
+
+	var expanded string
+	if s == "!!" {
+		if len(lr.history) == 0 {
+			return "", errors.New("!!: event not found")
+		}
+		expanded = lr.history[len(lr.history)-1]
+	} else if n, err := strconv.Atoi(s[1:]); err == nil {
+		if n < 1 || n > len(lr.history) {
+			return "", errors.New(s + ": event not found")
+		}
+		expanded = lr.history[n-1]
+	} else {
+		for i := len(lr.history) - 1; i >= 0; i-- {
+			if strings.HasPrefix(lr.history[i], s[1:]) {
+				expanded = lr.history[i]
+				break
+			}
+		}
+		if expanded == "" {
+			return "", errors.New(s + ": event not found")
+		}
+	}
+
+	lr.write([]byte(expanded + "\r\n"))
+	return expanded, nil
+}
+
+func (lr *lineReader) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	// keeps the passwords out of the history
+	if args, err := splitArgs(line); err == nil && len(args) > 0 && args[0] == "login" {
+		return
+	}
+	if len(lr.history) > 0 && lr.history[len(lr.history)-1] == line {
+		return
+	}
+	if len(lr.history) == maxHistory {
+		lr.history = lr.history[1:]
+	}
+	lr.history = append(lr.history, line)
+}
+
+// the numbered history, for the history command
+func (lr *lineReader) listHistory() string {
+	lines := make([]string, len(lr.history))
+	for i, line := range lr.history {
+		lines[i] = fmt.Sprintf("%4d  %v", i+1, line)
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// waitInterrupt discards the input until Ctrl-C (or a cancel line for the
+// clients without character mode) or until done is closed, it returns whether
+// Ctrl-C was pressed
+func (lr *lineReader) waitInterrupt(done <-chan struct{}) (bool, error) {
+	lr.stop = done
+	defer func() {
+		lr.stop = nil
+	}()
+
+	var line []byte
+	for {
+		b, err := lr.readByte()
+		if err == errStopped {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch b {
+		case 3:
+			return true, nil
+		case '\n':
+			if strings.TrimSpace(string(line)) == "cancel" {
+				return true, nil
+			}
+			line = line[:0]
+		default:
+			line = append(line, b)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the lines written and not sent yet, a command writing faster than its
+	// client reads is cancelled
+	lenStreamLines = 4096
+)
+
+// the time a cancelled command has to close its stream before the session
+// stops waiting for it
+var cancelTimeout = 10 * time.Second
+
+// the output of a streaming command, cancelled by Ctrl-C or when the
+// session is closed. The lines are queued, writing never blocks
+type Stream struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mutex      sync.Mutex
+	lines      chan string
+	closed     chan struct{}
+	overflowed bool
+}
+
+func newStream(ctx context.Context) *Stream {
+	s := new(Stream)
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.lines = make(chan string, lenStreamLines)
+	s.closed = make(chan struct{})
+	return s
+}
+
+// the lines written after the command is cancelled or the stream is closed
+// are discarded
+// goroutine safe
+func (s *Stream) Println(a ...interface{}) {
+	s.writeLines(strings.TrimSuffix(fmt.Sprintln(a...), "\n"))
+}
+
+// goroutine safe
+func (s *Stream) Printf(format string, a ...interface{}) {
+	s.writeLines(strings.TrimSuffix(fmt.Sprintf(format, a...), "\n"))
+}
+
+func (s *Stream) writeLines(text string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ctx.Err() != nil || s.isClosed() {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		select {
+		case s.lines <- strings.TrimSuffix(line, "\r"):
+		default:
+			s.overflowed = true
+			s.cancel()
+			return
+		}
+	}
+}
+
+// closed when the command is cancelled
+// goroutine safe
+func (s *Stream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// whether the command is cancelled
+// goroutine safe
+func (s *Stream) Cancelled() bool {
+	return s.ctx.Err() != nil
+}
+
+// cancelled with the command, for the functions taking a context
+// goroutine safe
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// Close ends the output of the command, a command registered by
+// RegisterExternalStream runs until its stream is closed. The calls after the
+// first one do nothing
+// goroutine safe
+func (s *Stream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isClosed() {
+		close(s.closed)
+	}
+}
+
+func (s *Stream) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain writes the lines of s until s is closed or stop is closed, or until
+// cancelTimeout after s is cancelled. It returns whether s is closed
+func (s *Stream) drain(write func(line string), stop <-chan struct{}) bool {
+	cancelled := s.ctx.Done()
+	var timeout <-chan time.Time
+	for {
+		select {
+		case line := <-s.lines:
+			write(line)
+		case <-s.closed:
+			// the lines are queued before Close returns
+			for {
+				select {
+				case line := <-s.lines:
+					write(line)
+				default:
+					return true
+				}
+			}
+		case <-cancelled:
+			cancelled = nil
+			s.mutex.Lock()
+			overflowed := s.overflowed
+			s.mutex.Unlock()
+			if overflowed {
+				write(fmt.Sprintf("more than %v lines not sent, cancelled", lenStreamLines))
+			}
+			timer := time.NewTimer(cancelTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		case <-timeout:
+			return false
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// a command writing its output while it runs
+type streamer interface {
+	Command
+	// starts the command, s is closed when it ends
+	start(s *Stream, args []string)
+}
+
+// runs a streaming command to the end and returns the whole output
+func collect(c streamer, args []string) string {
+	var lines []string
+	s := newStream(context.Background())
+	defer s.cancel()
+
+	c.start(s, args)
+	s.drain(func(line string) {
+		lines = append(lines, line)
+	}, nil)
+	return strings.Join(lines, "\r\n")
+}
+
+// a command writing its output while it runs on its own goroutine
+type StreamCommand struct {
+	_name string
+	_help string
+	f     func(s *Stream, args []string)
+}
+
+func (c *StreamCommand) name() string {
+	return c._name
+}
+
+func (c *StreamCommand) help() string {
+	return c._help
+}
+
+func (c *StreamCommand) run(args []string) string {
+	return collect(c, args)
+}
+
+func (c *StreamCommand) start(s *Stream, args []string) {
+	go func() {
+		defer s.Close()
+		defer func() {
+			if r := recover(); r != nil {
+				if conf.LenStackBuf > 0 {
+					buf := make([]byte, conf.LenStackBuf)
+					l := runtime.Stack(buf, false)
+					log.Error("%v: %s", r, buf[:l])
+				} else {
+					log.Error("%v", r)
+				}
+				s.Printf("%v", r)
+			}
+		}()
+
+		c.f(s, args)
+	}()
+}
+
+// RegisterStream registers a long running command, e.g. a data migration.
+// Every run of the command calls f on its own goroutine, f writes its output
+// to s while it runs and should return soon after s is cancelled (Ctrl-C in
+// the console, or a cancel line from a client without character mode)
+// f must be goroutine safe
+// you must call the function before calling console.Init
+// goroutine not safe
+func RegisterStream(name string, help string, f func(s *Stream, args []string)) {
+	for _, c := range commands {
+		if c.name() == name {
+			log.Fatal("command %v is already registered", name)
+		}
+	}
+
+	c := new(StreamCommand)
+	c._name = name
+	c._help = help
+	c.f = f
+	commands = append(commands, c)
+}
+
+// a streaming command executed by the goroutine of a chanrpc server, e.g.
+// the goroutine of a module
+type ExternalStreamCommand struct {
+	_name  string
+	_help  string
+	server *chanrpc.Server
+}
+
+func (c *ExternalStreamCommand) name() string {
+	return c._name
+}
+
+func (c *ExternalStreamCommand) help() string {
+	return c._help
+}
+
+func (c *ExternalStreamCommand) run(args []string) string {
+	return collect(c, args)
+}
+
+func (c *ExternalStreamCommand) start(s *Stream, args []string) {
+	go func() {
+		err := c.server.Call0(c._name, s, args)
+		if err != nil {
+			s.Println(err)
+			s.Close()
+		}
+	}()
+}
+
+// RegisterExternalStream registers a long running command executed by the
+// goroutine of server. Every run of the command calls f on that goroutine,
+// f writes its output to s and closes s when the output ends. f may return
+// before, e.g. to do the work in steps on the goroutine of a module, each
+// step checking whether s is cancelled. The session waits for s to be closed,
+// at most cancelTimeout after the command is cancelled
+// you must call the function before calling console.Init
+// goroutine not safe
+func RegisterExternalStream(name string, help string, f func(s *Stream, args []string), server *chanrpc.Server) {
+	for _, c := range commands {
+		if c.name() == name {
+			log.Fatal("command %v is already registered", name)
+		}
+	}
+
+	server.Register(name, func(args []interface{}) {
+		s := args[0].(*Stream)
+		defer func() {
+			if r := recover(); r != nil {
+				s.Printf("%v", r)
+				s.Close()
+				panic(r)
+			}
+		}()
+		f(s, args[1].([]string))
+	})
+
+	c := new(ExternalStreamCommand)
+	c._name = name
+	c._help = help
+	c.server = server
+	commands = append(commands, c)
+}
+
+// runs a streaming command in a session until it returns or is cancelled,
+// returns false if the session is closed
+func (a *Agent) runStream(c streamer, args []string) bool {
+	s := newStream(context.Background())
+	defer s.cancel()
+
+	// the output is written by its own goroutine, the session goroutine reads
+	// Ctrl-C
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var closed bool
+	c.start(s, args)
+	go func() {
+		defer close(done)
+		closed = s.drain(func(line string) {
+			a.conn.Write([]byte(line + "\r\n"))
+		}, stop)
+	}()
+
+	interrupted, err := a.reader.waitInterrupt(done)
+	if err != nil {
+		close(stop)
+		return false
+	}
+	if interrupted {
+		s.cancel()
+
+		// Ctrl-C again stops waiting for the command
+		key := "cancel"
+		if a.reader.charMode {
+			key = "Ctrl-C"
+		}
+		a.conn.Write([]byte("cancelling " + c.name() + ", " + key + " again to detach\r\n"))
+		interrupted, err = a.reader.waitInterrupt(done)
+		if err != nil {
+			close(stop)
+			return false
+		}
+		if interrupted {
+			close(stop)
+			<-done
+		}
+	}
+	if !closed {
+		a.conn.Write([]byte(c.name() + " detached, still running\r\n"))
+	} else if s.Cancelled() {
+		a.conn.Write([]byte(c.name() + " cancelled\r\n"))
+	}
+	return true
+}
+
+// writes every line as a JSON object {"line": ...}, the command is cancelled
+// when the client goes away
+func serveStream(c streamer, w http.ResponseWriter, r *http.Request, args []string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	e := json.NewEncoder(w)
+
+	s := newStream(r.Context())
+	defer s.cancel()
+
+	c.start(s, args)
+	closed := s.drain(func(line string) {
+		e.Encode(streamLine{line})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}, r.Context().Done())
+	if !closed && r.Context().Err() == nil {
+		e.Encode(streamLine{c.name() + " detached, still running"})
+	}
+}
+
+type streamLine struct {
+	Line string `json:"line"`
+}
@@ -3,8 +3,10 @@ package mongodb
 import (
 	"container/heap"
 	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/metrics"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"strings"
 	"sync"
 	"time"
 )
@@ -49,6 +51,53 @@ func (h *SessionHeap) Pop() interface{} {
 type DialContext struct {
 	sync.Mutex
 	sessions SessionHeap
+	// the servers of the url, without the credentials
+	addrs string
+}
+
+// the open dial contexts, for the metrics
+var (
+	dialContexts      = make(map[*DialContext]struct{})
+	mutexDialContexts sync.Mutex
+)
+
+func init() {
+	metrics.NewGaugeFunc("leaf_mongodb_sessions", "Sessions of the open MongoDB dial contexts.",
+		[]string{"addrs"},
+		func(set func(value float64, labelValues ...string)) {
+			for addrs, n := range sumDialContexts(func(c *DialContext) int {
+				return len(c.sessions)
+			}) {
+				set(float64(n), addrs)
+			}
+		})
+	metrics.NewGaugeFunc("leaf_mongodb_session_refs", "References to the sessions of the open MongoDB dial contexts.",
+		[]string{"addrs"},
+		func(set func(value float64, labelValues ...string)) {
+			for addrs, n := range sumDialContexts(func(c *DialContext) int {
+				ref := 0
+				for _, s := range c.sessions {
+					ref += s.ref
+				}
+				return ref
+			}) {
+				set(float64(n), addrs)
+			}
+		})
+}
+
+// sums f over the open dial contexts, by addrs
+func sumDialContexts(f func(c *DialContext) int) map[string]int {
+	mutexDialContexts.Lock()
+	defer mutexDialContexts.Unlock()
+
+	sums := make(map[string]int)
+	for c := range dialContexts {
+		c.Lock()
+		sums[c.addrs] += f(c)
+		c.Unlock()
+	}
+	return sums
 }
 
 // goroutine safe
@@ -81,11 +130,22 @@ func DialWithTimeout(url string, sessionNum int, dialTimeout time.Duration, time
 	}
 	heap.Init(&c.sessions)
 
+	if info, err := mgo.ParseURL(url); err == nil {
+		c.addrs = strings.Join(info.Addrs, ",")
+	}
+	mutexDialContexts.Lock()
+	dialContexts[c] = struct{}{}
+	mutexDialContexts.Unlock()
+
 	return c, nil
 }
 
 // goroutine safe
 func (c *DialContext) Close() {
+	mutexDialContexts.Lock()
+	delete(dialContexts, c)
+	mutexDialContexts.Unlock()
+
 	c.Lock()
 	for _, s := range c.sessions {
 		s.Close()
@@ -4,6 +4,7 @@ import (
 	"github.com/name5566/leaf/chanrpc"
 	"github.com/name5566/leaf/log"
 	"github.com/name5566/leaf/network"
+	"github.com/name5566/leaf/tracing"
 	"net"
 	"reflect"
 	"time"
@@ -72,7 +73,9 @@ func (gate *Gate) Run(closeSig chan bool) {
 	if tcpServer != nil {
 		tcpServer.Start()
 	}
+	addRunning(gate, tcpServer, wsServer)
 	<-closeSig
+	removeRunning(gate)
 	if wsServer != nil {
 		wsServer.Close()
 	}
@@ -96,6 +99,7 @@ func (a *agent) Run() {
 			log.Debug("read message: %v", err)
 			break
 		}
+		bytesIn.Add(float64(len(data)))
 
 		if a.gate.Processor != nil {
 			msg, err := a.gate.Processor.Unmarshal(data)
@@ -103,7 +107,8 @@ func (a *agent) Run() {
 				log.Debug("unmarshal message error: %v", err)
 				break
 			}
-			err = a.gate.Processor.Route(msg, a)
+			messagesIn.Inc(msgType(msg))
+			err = a.route(msg, len(data))
 			if err != nil {
 				log.Debug("route message error: %v", err)
 				break
@@ -112,6 +117,28 @@ func (a *agent) Run() {
 	}
 }
 
+// a trace is started for every message if the Processor is a
+// network.SpanProcessor. The span "gate route <type>" (a server span, the
+// message comes from a client) measures the routing of the message until it
+// is queued, the handling is its child span on the chanrpc server and ends
+// later
+func (a *agent) route(msg interface{}, size int) error {
+	p, ok := a.gate.Processor.(network.SpanProcessor)
+	if !ok {
+		return a.gate.Processor.Route(msg, a)
+	}
+
+	span := tracing.Start("gate route " + msgType(msg))
+	span.SetKind(tracing.KindServer)
+	span.SetAttr("message.type", msgType(msg))
+	span.SetAttr("message.size", size)
+	span.SetAttr("net.peer.addr", a.conn.RemoteAddr().String())
+	err := p.RouteSpan(msg, a, span)
+	span.SetError(err)
+	span.End()
+	return err
+}
+
 func (a *agent) OnClose() {
 	if a.gate.AgentChanRPC != nil {
 		err := a.gate.AgentChanRPC.Call0("CloseAgent", a)
@@ -131,6 +158,11 @@ func (a *agent) WriteMsg(msg interface{}) {
 		err = a.conn.WriteMsg(data...)
 		if err != nil {
 			log.Error("write message %v error: %v", reflect.TypeOf(msg), err)
+			return
+		}
+		messagesOut.Inc(msgType(msg))
+		for _, b := range data {
+			bytesOut.Add(float64(len(b)))
 		}
 	}
 }
@@ -0,0 +1,37 @@
+package gate
+
+import (
+	"github.com/name5566/leaf/metrics"
+	"reflect"
+	"strings"
+)
+
+var (
+	messagesIn  = metrics.NewCounter("leaf_gate_messages_in_total", "Messages received by the gates.", "type")
+	messagesOut = metrics.NewCounter("leaf_gate_messages_out_total", "Messages sent by the gates.", "type")
+	bytesIn     = metrics.NewCounter("leaf_gate_bytes_in_total", "Bytes of the messages received by the gates.")
+	bytesOut    = metrics.NewCounter("leaf_gate_bytes_out_total", "Bytes of the messages sent by the gates.")
+)
+
+func init() {
+	metrics.NewGaugeFunc("leaf_gate_connections", "Connections of the gate listeners.",
+		[]string{"listener", "addr"},
+		func(set func(value float64, labelValues ...string)) {
+			for _, s := range GateStats() {
+				if s.TCPAddr != "" {
+					set(float64(s.TCPConns), "tcp", s.TCPAddr)
+				}
+				if s.WSAddr != "" {
+					set(float64(s.WSConns), "ws", s.WSAddr)
+				}
+			}
+		})
+}
+
+// e.g. msg.Hello
+func msgType(msg interface{}) string {
+	if msg == nil {
+		return "nil"
+	}
+	return strings.TrimPrefix(reflect.TypeOf(msg).String(), "*")
+}
@@ -0,0 +1,96 @@
+package gate
+
+import (
+	"github.com/name5566/leaf/console"
+	"github.com/name5566/leaf/network"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the connections of a gate, the address of a listener not started is empty
+type GateStat struct {
+	TCPAddr       string
+	TCPConns      int
+	TCPMaxConnNum int
+	WSAddr        string
+	WSConns       int
+	WSMaxConnNum  int
+}
+
+type listeners struct {
+	tcpServer *network.TCPServer
+	wsServer  *network.WSServer
+}
+
+var (
+	running      = make(map[*Gate]listeners)
+	mutexRunning sync.Mutex
+)
+
+func init() {
+	console.RegisterFunc("gate", "connection counts of the running gates", commandGate)
+}
+
+func addRunning(gate *Gate, tcpServer *network.TCPServer, wsServer *network.WSServer) {
+	mutexRunning.Lock()
+	running[gate] = listeners{tcpServer, wsServer}
+	mutexRunning.Unlock()
+}
+
+func removeRunning(gate *Gate) {
+	mutexRunning.Lock()
+	delete(running, gate)
+	mutexRunning.Unlock()
+}
+
+// the connection counts of the running gates
+// goroutine safe
+func GateStats() []GateStat {
+	mutexRunning.Lock()
+	defer mutexRunning.Unlock()
+
+	stats := make([]GateStat, 0, len(running))
+	for _, l := range running {
+		var stat GateStat
+		if l.tcpServer != nil {
+			stat.TCPAddr = l.tcpServer.Addr
+			stat.TCPConns = l.tcpServer.NumConn()
+			stat.TCPMaxConnNum = l.tcpServer.MaxConnNum
+		}
+		if l.wsServer != nil {
+			stat.WSAddr = l.wsServer.Addr
+			stat.WSConns = l.wsServer.NumConn()
+			stat.WSMaxConnNum = l.wsServer.MaxConnNum
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TCPAddr != stats[j].TCPAddr {
+			return stats[i].TCPAddr < stats[j].TCPAddr
+		}
+		return stats[i].WSAddr < stats[j].WSAddr
+	})
+	return stats
+}
+
+func commandGate(args []string) string {
+	stats := GateStats()
+	if len(stats) == 0 {
+		return "no gate running"
+	}
+
+	var lines []string
+	for _, s := range stats {
+		if s.TCPAddr != "" {
+			lines = append(lines, "tcp "+s.TCPAddr+" - "+
+				strconv.Itoa(s.TCPConns)+"/"+strconv.Itoa(s.TCPMaxConnNum)+" connections")
+		}
+		if s.WSAddr != "" {
+			lines = append(lines, "ws "+s.WSAddr+" - "+
+				strconv.Itoa(s.WSConns)+"/"+strconv.Itoa(s.WSMaxConnNum)+" connections")
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
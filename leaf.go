@@ -5,42 +5,209 @@ import (
 	"github.com/name5566/leaf/conf"
 	"github.com/name5566/leaf/console"
 	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/metrics"
 	"github.com/name5566/leaf/module"
+	"github.com/name5566/leaf/tracing"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+var (
+	// closed down by Stop, nil when no Leaf is running
+	chanStop  chan bool
+	mutexStop sync.Mutex
+)
+
+// Run runs the modules with the settings of the conf variables
 func Run(mods ...module.Module) {
+	RunConfig(conf.Default(), mods...)
+}
+
+// RunConfig runs the modules with the settings c, c must not be changed
+// after. The conf variables are not read, except LenStackBuf which is set to
+// c.LenStackBuf as it is read by the low level packages (chanrpc, go, timer)
+func RunConfig(c *conf.Config, mods ...module.Module) {
+	stop := make(chan bool, 1)
+	mutexStop.Lock()
+	chanStop = stop
+	mutexStop.Unlock()
+	defer func() {
+		mutexStop.Lock()
+		chanStop = nil
+		mutexStop.Unlock()
+	}()
+
+	conf.LenStackBuf = c.LenStackBuf
+
 	// logger
-	if conf.LogLevel != "" {
-		logger, err := log.New(conf.LogLevel, conf.LogPath, conf.LogFlag)
+	if c.LogLevel != "" {
+		logger, err := newLogger(c)
 		if err != nil {
 			panic(err)
 		}
+		for pkg, level := range c.LogPackageLevels {
+			err = logger.SetPackageLevel(pkg, level)
+			if err != nil {
+				panic(err)
+			}
+		}
+		logger.SetDedup(time.Duration(c.LogDedupWindow))
+		logger.SetSampling(time.Duration(c.LogSampleInterval), c.LogSampleFirst, c.LogSampleThereafter)
 		log.Export(logger)
 		defer logger.Close()
 	}
 
 	log.Release("Leaf %v starting up", version)
 
+	// tracing
+	tracing.InitConfig(c)
+
 	// module
 	for i := 0; i < len(mods); i++ {
 		module.Register(mods[i])
 	}
-	module.Init()
+	err := module.InitConfig(c)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
 
 	// cluster
-	cluster.Init()
+	cluster.InitConfig(c)
+
+	// metrics
+	metrics.InitConfig(c)
 
 	// console
-	console.Init()
+	console.Version = version
+	console.InitConfig(c)
 
 	// close
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-	sig := <-c
-	log.Release("Leaf closing down (signal: %v)", sig)
+	sigs := conf.CloseSignals
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+	select {
+	case sig := <-ch:
+		log.Release("Leaf closing down (signal: %v)", sig)
+	case <-stop:
+		log.Release("Leaf closing down (stopped)")
+	}
+	closeDown(time.Duration(c.CloseTimeout))
+}
+
+// creates the logger from the log settings of c
+func newLogger(c *conf.Config) (*log.Logger, error) {
+	overflow, err := log.ParseOverflow(c.LogOverflow)
+	if err != nil {
+		return nil, err
+	}
+	async := func(w io.Writer) io.Writer {
+		if c.LogAsync > 0 {
+			return log.NewAsyncWriter(w, c.LogAsync, overflow)
+		}
+		return w
+	}
+
+	if c.LogPath == "" {
+		return log.NewSinks(c.LogLevel, log.Sink{
+			Format: c.LogFormat,
+			Flag:   c.LogFlag,
+			Writer: async(os.Stdout),
+		})
+	}
+
+	rw, err := log.NewRotateWriter(log.RotateConfig{
+		Path:       c.LogPath,
+		MaxSize:    int64(c.LogMaxSize) << 20,
+		Interval:   time.Duration(c.LogRotateInterval),
+		MaxBackups: c.LogMaxBackups,
+		MaxAge:     time.Duration(c.LogMaxAge),
+		Compress:   c.LogCompress,
+		Prefix:     c.LogPrefix,
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := async(rw)
+	sinks := []log.Sink{{
+		Format: c.LogFormat,
+		Flag:   c.LogFlag,
+		Writer: w,
+	}}
+	if c.LogStdoutLevel != "" {
+		sinks = append(sinks, log.Sink{
+			Level:  c.LogStdoutLevel,
+			Format: c.LogFormat,
+			Flag:   c.LogFlag,
+			Writer: async(os.Stdout),
+		})
+	}
+
+	logger, err := log.NewSinks(c.LogLevel, sinks...)
+	if err != nil {
+		w.(io.Closer).Close()
+		return nil, err
+	}
+	return logger, nil
+}
+
+// makes Run close down as if a close signal was received, does nothing if
+// Run is not running
+// goroutine safe
+func Stop() {
+	mutexStop.Lock()
+	defer mutexStop.Unlock()
+
+	if chanStop == nil {
+		return
+	}
+	select {
+	case chanStop <- true:
+	default:
+	}
+}
+
+func closeDown(timeout time.Duration) {
+	if timeout <= 0 {
+		destroy()
+		return
+	}
+
+	done := make(chan bool)
+	go func() {
+		destroy()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		var stopping, running []string
+		for _, name := range module.Names() {
+			switch state, _ := module.StateOf(name); state {
+			case module.StateStopping:
+				stopping = append(stopping, name)
+			case module.StateRunning:
+				running = append(running, name)
+			}
+		}
+		log.Fatal("Leaf close timeout (%v), stopping modules: [%v], running modules: [%v]",
+			timeout, strings.Join(stopping, ", "), strings.Join(running, ", "))
+	}
+}
+
+func destroy() {
 	console.Destroy()
+	metrics.Destroy()
 	cluster.Destroy()
 	module.Destroy()
+	tracing.Destroy()
 }
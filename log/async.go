@@ -0,0 +1,168 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// what an AsyncWriter does with a line when its buffer is full
+type Overflow int
+
+const (
+	// wait for room in the buffer
+	OverflowBlock Overflow = iota
+	// drop the line, the dropped lines are counted by Dropped
+	OverflowDrop
+	// drop the line and write the number of dropped lines once the buffer
+	// is drained
+	OverflowReport
+)
+
+func ParseOverflow(s string) (Overflow, error) {
+	switch strings.ToLower(s) {
+	case "", "block":
+		return OverflowBlock, nil
+	case "drop":
+		return OverflowDrop, nil
+	case "report":
+		return OverflowReport, nil
+	default:
+		return 0, errors.New("unknown overflow policy: " + s)
+	}
+}
+
+// AsyncWriter writes the lines to w from its own goroutine, so that slow I/O
+// does not stall the goroutines logging
+type AsyncWriter struct {
+	w        io.Writer
+	overflow Overflow
+	mutex    sync.RWMutex
+	closed   bool
+	chanItem chan asyncItem
+	chanDone chan struct{}
+	dropped  uint64
+	reported uint64
+}
+
+// a line, or a flush closing flushed
+type asyncItem struct {
+	line    []byte
+	flushed chan struct{}
+}
+
+var errAsyncClosed = errors.New("async writer closed")
+
+// NewAsyncWriter creates an AsyncWriter buffering at most size lines
+func NewAsyncWriter(w io.Writer, size int, overflow Overflow) *AsyncWriter {
+	if size <= 0 {
+		size = 1
+	}
+
+	a := new(AsyncWriter)
+	a.w = w
+	a.overflow = overflow
+	a.chanItem = make(chan asyncItem, size)
+	a.chanDone = make(chan struct{})
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.chanDone)
+
+	for item := range a.chanItem {
+		if item.flushed != nil {
+			a.report()
+			close(item.flushed)
+			continue
+		}
+
+		a.w.Write(item.line)
+		if len(a.chanItem) == 0 {
+			a.report()
+		}
+	}
+	a.report()
+}
+
+func (a *AsyncWriter) report() {
+	if a.overflow != OverflowReport {
+		return
+	}
+	dropped := atomic.LoadUint64(&a.dropped)
+	if dropped > a.reported {
+		fmt.Fprintf(a.w, "[log    ] %v lines dropped\n", dropped-a.reported)
+		a.reported = dropped
+	}
+}
+
+// goroutine safe
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	// the caller may reuse p
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a.closed {
+		return 0, errAsyncClosed
+	}
+
+	if a.overflow == OverflowBlock {
+		a.chanItem <- asyncItem{line: line}
+		return len(p), nil
+	}
+	select {
+	case a.chanItem <- asyncItem{line: line}:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Flush waits for the lines written before to be written to w
+// goroutine safe
+func (a *AsyncWriter) Flush() error {
+	flushed := make(chan struct{})
+
+	a.mutex.RLock()
+	if a.closed {
+		a.mutex.RUnlock()
+		return errAsyncClosed
+	}
+	a.chanItem <- asyncItem{flushed: flushed}
+	a.mutex.RUnlock()
+
+	<-flushed
+	return nil
+}
+
+// Close writes the buffered lines and closes w (if it is an io.Closer other
+// than os.Stdout and os.Stderr)
+// goroutine safe
+func (a *AsyncWriter) Close() error {
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.chanItem)
+	a.mutex.Unlock()
+
+	<-a.chanDone
+	if c := closerOf(a.w); c != nil {
+		return c.Close()
+	}
+	return nil
+}
+
+// the number of lines dropped
+// goroutine safe
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
@@ -1,8 +1,14 @@
 package log_test
 
 import (
+	"errors"
+	"fmt"
 	"github.com/name5566/leaf/log"
+	"io/ioutil"
 	l "log"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 func Example() {
@@ -27,3 +33,140 @@ func Example() {
 	log.Debug("will not print")
 	log.Release("My name is %v", name)
 }
+
+func ExampleLogger_With() {
+	logger, err := log.New("debug", "", 0)
+	if err != nil {
+		return
+	}
+
+	game := logger.With("module", "game")
+	game.Debugw("player login", "id", 1001, "name", "Leaf Fan")
+	game.Release("player %v logout", 1001)
+
+	game.SetFormat("json")
+	game.Errorw("unmarshal message error", "id", 1001, "err", errors.New("bad length"))
+
+	// Output:
+	// [debug  ] player login module=game id=1001 name="Leaf Fan"
+	// [release] player 1001 logout module=game
+	// {"level":"error","msg":"unmarshal message error","module":"game","id":1001,"err":"bad length"}
+}
+
+func ExampleNewSinks() {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := log.NewRotateWriter(log.RotateConfig{
+		Path:       dir,
+		MaxSize:    64,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	if err != nil {
+		return
+	}
+
+	logger, err := log.NewSinks("debug",
+		log.Sink{Level: "release"},
+		log.Sink{Writer: w, Format: "json"},
+	)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < 5; i++ {
+		logger.Debug("debug message %v", i)
+	}
+	logger.Release("release message")
+	logger.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	gzFiles, _ := filepath.Glob(filepath.Join(dir, "*.log.gz"))
+	fmt.Println(len(files), len(gzFiles))
+
+	// Output:
+	// [release] release message
+	// 1 2
+}
+
+func ExampleNewAsyncWriter() {
+	w := log.NewAsyncWriter(os.Stdout, 1024, log.OverflowReport)
+	logger, err := log.NewSinks("debug", log.Sink{Writer: w})
+	if err != nil {
+		return
+	}
+
+	logger.Release("written by the goroutine of w")
+
+	// flushes w
+	logger.Close()
+
+	// Output:
+	// [release] written by the goroutine of w
+}
+
+func ExampleLogger_SetPackageLevel() {
+	logger, err := log.New("release", "", 0)
+	if err != nil {
+		return
+	}
+	defer logger.Close()
+
+	logger.Debug("will not print")
+
+	// the lines logged from this package
+	logger.SetPackageLevel("log_test", "trace")
+	logger.Trace("My name is %v", "Leaf")
+	fmt.Println(logger.Level(), logger.PackageLevels())
+
+	logger.SetPackageLevel("log_test", "")
+	logger.Trace("will not print")
+
+	// Output:
+	// [trace  ] My name is Leaf
+	// release map[log_test:trace]
+}
+
+func ExampleLogger_SetDedup() {
+	logger, err := log.New("debug", "", 0)
+	if err != nil {
+		return
+	}
+
+	logger.SetDedup(time.Minute)
+	for i := 0; i < 5; i++ {
+		logger.Error("unmarshal message error: %v", "invalid json data")
+	}
+	logger.Error("unmarshal message error: %v", "message Hello not registered")
+
+	// reports the pending repeats
+	logger.Close()
+
+	// Output:
+	// [error  ] unmarshal message error: invalid json data
+	// [error  ] unmarshal message error: message Hello not registered
+	// [error  ] message "unmarshal message error: invalid json data" repeated 4 times in 1m0s
+}
+
+func ExampleLogger_SetSampling() {
+	logger, err := log.New("debug", "", 0)
+	if err != nil {
+		return
+	}
+	defer logger.Close()
+
+	logger.SetSampling(time.Minute, 2, 3)
+	for i := 0; i < 10; i++ {
+		logger.Debug("message %v", i)
+	}
+
+	// Output:
+	// [debug  ] message 0
+	// [debug  ] message 1
+	// [debug  ] message 4
+	// [debug  ] message 7
+}
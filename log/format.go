@@ -0,0 +1,167 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// formats
+const (
+	textFormat = 0
+	jsonFormat = 1
+)
+
+func levelName(level int32) string {
+	switch level {
+	case traceLevel:
+		return "trace"
+	case debugLevel:
+		return "debug"
+	case releaseLevel:
+		return "release"
+	case errorLevel:
+		return "error"
+	default:
+		return "fatal"
+	}
+}
+
+func parseFormat(strFormat string) (int32, error) {
+	switch strings.ToLower(strFormat) {
+	case "", "text":
+		return textFormat, nil
+	case "json":
+		return jsonFormat, nil
+	default:
+		return 0, errors.New("unknown format: " + strFormat)
+	}
+}
+
+// SetFormat sets the format of the lines of all sinks, text (default) or
+// json. A json line is an object holding the time and the caller (if the flag
+// of the sink asks for them), the level, the message and the fields
+// goroutine safe
+func (logger *Logger) SetFormat(strFormat string) error {
+	format, err := parseFormat(strFormat)
+	if err != nil {
+		return err
+	}
+	for _, s := range logger.sinks {
+		s.setFormat(format)
+	}
+	return nil
+}
+
+func (s *sink) setFormat(format int32) {
+	atomic.StoreInt32(&s.format, format)
+	if format == jsonFormat {
+		s.baseLogger.SetFlags(0)
+	} else {
+		s.baseLogger.SetFlags(s.flag)
+	}
+}
+
+// file:line as written by the flag of the sink, empty if the flag has no
+// file
+func (s *sink) caller(file string, line int) string {
+	if s.flag&(log.Lshortfile|log.Llongfile) == 0 {
+		return ""
+	}
+	if file == "" {
+		file = "???"
+	} else if s.flag&log.Lshortfile != 0 {
+		file = file[strings.LastIndex(file, "/")+1:]
+	}
+	return file + ":" + strconv.Itoa(line)
+}
+
+// the key of the field i of keysAndValues
+func fieldKey(keysAndValues []interface{}, i int) string {
+	if s, ok := keysAndValues[i].(string); ok {
+		return s
+	}
+	return fmt.Sprint(keysAndValues[i])
+}
+
+// the value of the field i of keysAndValues
+func fieldValue(keysAndValues []interface{}, i int) interface{} {
+	if i+1 >= len(keysAndValues) {
+		return "!MISSING"
+	}
+	v := keysAndValues[i+1]
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
+
+// " key=value" for every field, values with spaces, quotes or '=' are quoted
+func formatText(keysAndValues []interface{}) string {
+	if len(keysAndValues) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(keysAndValues); i += 2 {
+		s := fmt.Sprint(fieldValue(keysAndValues, i))
+		if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(" ")
+		b.WriteString(fieldKey(keysAndValues, i))
+		b.WriteString("=")
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// the caller is found at calldepth if caller is empty
+func (s *sink) formatJSON(calldepth int, caller string, level int32, msg string, keysAndValues []interface{}) string {
+	var b bytes.Buffer
+	writeField := func(key string, value interface{}) {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		} else {
+			b.WriteByte('{')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.Write(v)
+	}
+
+	if s.flag&(log.Ldate|log.Ltime|log.Lmicroseconds) != 0 {
+		now := time.Now()
+		if s.flag&log.LUTC != 0 {
+			now = now.UTC()
+		}
+		writeField("time", now.Format("2006-01-02T15:04:05.000000Z07:00"))
+	}
+	writeField("level", levelName(level))
+	if s.flag&(log.Lshortfile|log.Llongfile) != 0 {
+		if caller == "" {
+			_, file, line, _ := runtime.Caller(calldepth)
+			caller = s.caller(file, line)
+		}
+		writeField("caller", caller)
+	}
+	writeField("msg", msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		writeField(fieldKey(keysAndValues, i), fieldValue(keysAndValues, i))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
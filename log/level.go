@@ -0,0 +1,117 @@
+package log
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// the package of the function at a program counter
+var pcPackages sync.Map
+
+// SetPackageLevel sets the level of the lines logged from a package instead
+// of the level of the logger. pkg is an import path or its last elements,
+// e.g. github.com/name5566/leaf/gate, leaf/gate or gate, the longest match
+// applies. An empty strLevel removes the level of the package
+// goroutine safe
+func (logger *Logger) SetPackageLevel(pkg string, strLevel string) error {
+	pkg = strings.Trim(pkg, "/")
+	var level int32
+	if strLevel != "" {
+		var err error
+		level, err = parseLevel(strLevel)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.mutexPackages.Lock()
+	defer logger.mutexPackages.Unlock()
+
+	old, _ := logger.packages.Load().(map[string]int32)
+	packages := make(map[string]int32, len(old)+1)
+	for p, l := range old {
+		packages[p] = l
+	}
+	if strLevel == "" {
+		delete(packages, pkg)
+	} else {
+		packages[pkg] = level
+	}
+	logger.packages.Store(packages)
+	logger.updateMinLevel()
+	return nil
+}
+
+// the levels of the packages
+// goroutine safe
+func (logger *Logger) PackageLevels() map[string]string {
+	packages, _ := logger.packages.Load().(map[string]int32)
+	levels := make(map[string]string, len(packages))
+	for p, l := range packages {
+		levels[p] = levelName(l)
+	}
+	return levels
+}
+
+// you must hold mutexPackages
+func (logger *Logger) updateMinLevel() {
+	min := atomic.LoadInt32(&logger.level)
+	packages, _ := logger.packages.Load().(map[string]int32)
+	for _, l := range packages {
+		if l < min {
+			min = l
+		}
+	}
+	atomic.StoreInt32(&logger.minLevel, min)
+}
+
+// whether a line of level logged by the caller at calldepth is written
+func (logger *Logger) enabled(level int32, calldepth int) bool {
+	if level < atomic.LoadInt32(&logger.minLevel) {
+		return false
+	}
+	packages, _ := logger.packages.Load().(map[string]int32)
+	if len(packages) == 0 {
+		return level >= atomic.LoadInt32(&logger.level)
+	}
+
+	var pcs [1]uintptr
+	if runtime.Callers(calldepth+1, pcs[:]) == 0 {
+		return level >= atomic.LoadInt32(&logger.level)
+	}
+	pkg := callerPackage(pcs[0])
+	for {
+		if l, ok := packages[pkg]; ok {
+			return level >= l
+		}
+		i := strings.Index(pkg, "/")
+		if i < 0 {
+			break
+		}
+		pkg = pkg[i+1:]
+	}
+	return level >= atomic.LoadInt32(&logger.level)
+}
+
+func callerPackage(pc uintptr) string {
+	if pkg, ok := pcPackages.Load(pc); ok {
+		return pkg.(string)
+	}
+
+	pkg := ""
+	if f := runtime.FuncForPC(pc - 1); f != nil {
+		// e.g. github.com/name5566/leaf/gate.(*agent).Run
+		name := f.Name()
+		slash := strings.LastIndex(name, "/")
+		dot := strings.Index(name[slash+1:], ".")
+		if dot >= 0 {
+			pkg = name[:slash+1+dot]
+		} else {
+			pkg = name
+		}
+	}
+	pcPackages.Store(pc, pkg)
+	return pkg
+}
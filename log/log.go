@@ -3,15 +3,18 @@ package log
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // levels
 const (
+	traceLevel   = -1
 	debugLevel   = 0
 	releaseLevel = 1
 	errorLevel   = 2
@@ -19,94 +22,202 @@ const (
 )
 
 const (
+	printTraceLevel   = "[trace  ] "
 	printDebugLevel   = "[debug  ] "
 	printReleaseLevel = "[release] "
 	printErrorLevel   = "[error  ] "
 	printFatalLevel   = "[fatal  ] "
 )
 
+// a Logger made by With shares the sinks and the level of its parent and
+// adds its fields to every line
 type Logger struct {
-	level      int
+	*core
+	fields []interface{}
+}
+
+type core struct {
+	level int32
+	sinks []*sink
+
+	// package levels
+	minLevel      int32
+	packages      atomic.Value
+	mutexPackages sync.Mutex
+
+	// duplicate suppression and sampling
+	limiter      atomic.Value
+	mutexLimiter sync.Mutex
+}
+
+type sink struct {
+	level      int32
+	format     int32
+	flag       int
 	baseLogger *log.Logger
-	baseFile   *os.File
+	// the text lines written for another call site, see outputAt
+	siteLogger *log.Logger
+	closer     io.Closer
+	flusher    flusher
 }
 
-func New(strLevel string, pathname string, flag int) (*Logger, error) {
-	// level
-	var level int
+func parseLevel(strLevel string) (int32, error) {
 	switch strings.ToLower(strLevel) {
+	case "trace":
+		return traceLevel, nil
 	case "debug":
-		level = debugLevel
+		return debugLevel, nil
 	case "release":
-		level = releaseLevel
+		return releaseLevel, nil
 	case "error":
-		level = errorLevel
+		return errorLevel, nil
 	case "fatal":
-		level = fatalLevel
+		return fatalLevel, nil
 	default:
-		return nil, errors.New("unknown level: " + strLevel)
+		return 0, errors.New("unknown level: " + strLevel)
 	}
+}
 
-	// logger
-	var baseLogger *log.Logger
-	var baseFile *os.File
+func New(strLevel string, pathname string, flag int) (*Logger, error) {
+	s := Sink{Flag: flag}
 	if pathname != "" {
-		now := time.Now()
-
-		filename := fmt.Sprintf("%d%02d%02d_%02d_%02d_%02d.log",
-			now.Year(),
-			now.Month(),
-			now.Day(),
-			now.Hour(),
-			now.Minute(),
-			now.Second())
-
-		file, err := os.Create(path.Join(pathname, filename))
+		w, err := NewRotateWriter(RotateConfig{Path: pathname})
 		if err != nil {
 			return nil, err
 		}
-
-		baseLogger = log.New(file, "", flag)
-		baseFile = file
-	} else {
-		baseLogger = log.New(os.Stdout, "", flag)
+		s.Writer = w
 	}
 
-	// new
-	logger := new(Logger)
-	logger.level = level
-	logger.baseLogger = baseLogger
-	logger.baseFile = baseFile
+	return NewSinks(strLevel, s)
+}
 
-	return logger, nil
+// With returns a logger adding the fields keysAndValues to those of logger,
+// it shares the sinks and the level of logger
+func (logger *Logger) With(keysAndValues ...interface{}) *Logger {
+	l := new(Logger)
+	l.core = logger.core
+	l.fields = append(logger.fields[:len(logger.fields):len(logger.fields)], keysAndValues...)
+	return l
 }
 
 // It's dangerous to call the method on logging
 func (logger *Logger) Close() {
-	if logger.baseFile != nil {
-		logger.baseFile.Close()
+	logger.mutexLimiter.Lock()
+	defer logger.mutexLimiter.Unlock()
+
+	if l := logger.loadLimiter(); l != nil {
+		l.close(logger)
+	}
+
+	for _, s := range logger.sinks {
+		if s.closer != nil {
+			s.closer.Close()
+		}
 	}
 
-	logger.baseLogger = nil
-	logger.baseFile = nil
+	logger.sinks = nil
+}
+
+// goroutine safe
+func (logger *Logger) SetLevel(strLevel string) error {
+	level, err := parseLevel(strLevel)
+	if err != nil {
+		return err
+	}
+
+	logger.mutexPackages.Lock()
+	defer logger.mutexPackages.Unlock()
+	atomic.StoreInt32(&logger.level, level)
+	logger.updateMinLevel()
+	return nil
+}
+
+// goroutine safe
+func (logger *Logger) Level() string {
+	return levelName(atomic.LoadInt32(&logger.level))
 }
 
-func (logger *Logger) doPrintf(level int, printLevel string, format string, a ...interface{}) {
-	if level < logger.level {
+func (logger *Logger) doPrintf(level int32, printLevel string, format string, a ...interface{}) {
+	if !logger.enabled(level, 3) {
 		return
 	}
-	if logger.baseLogger == nil {
+	msg := fmt.Sprintf(format, a...)
+	if !logger.allow(level, msg, nil, 3) {
+		return
+	}
+	logger.output(4, level, printLevel, msg, nil)
+}
+
+func (logger *Logger) doPrintw(level int32, printLevel string, msg string, keysAndValues []interface{}) {
+	if !logger.enabled(level, 3) || !logger.allow(level, msg, keysAndValues, 3) {
+		return
+	}
+	logger.output(4, level, printLevel, msg, keysAndValues)
+}
+
+func (logger *Logger) output(calldepth int, level int32, printLevel string, msg string, keysAndValues []interface{}) {
+	if logger.sinks == nil {
 		panic("logger closed")
 	}
 
-	format = printLevel + format
-	logger.baseLogger.Output(3, fmt.Sprintf(format, a...))
+	fields := logger.fields
+	if len(keysAndValues) > 0 {
+		fields = append(fields[:len(fields):len(fields)], keysAndValues...)
+	}
+
+	// room for the fatal line in the buffers
+	if level == fatalLevel {
+		logger.flush()
+	}
+
+	for _, s := range logger.sinks {
+		if level < s.level {
+			continue
+		}
+		if atomic.LoadInt32(&s.format) == jsonFormat {
+			s.baseLogger.Output(calldepth, s.formatJSON(calldepth, "", level, msg, fields))
+		} else {
+			s.baseLogger.Output(calldepth, printLevel+msg+formatText(fields))
+		}
+	}
 
 	if level == fatalLevel {
+		logger.flush()
 		os.Exit(1)
 	}
 }
 
+// writes a line for the call site file:line, e.g. a report written by a
+// timer for the lines of the call site
+func (logger *Logger) outputAt(file string, line int, level int32, printLevel string, msg string) {
+	for _, s := range logger.sinks {
+		if level < s.level {
+			continue
+		}
+		caller := s.caller(file, line)
+		if atomic.LoadInt32(&s.format) == jsonFormat {
+			s.baseLogger.Output(0, s.formatJSON(0, caller, level, msg, nil))
+		} else {
+			if caller != "" {
+				caller += ": "
+			}
+			s.siteLogger.Output(0, caller+printLevel+msg)
+		}
+	}
+}
+
+func (logger *Logger) flush() {
+	for _, s := range logger.sinks {
+		if s.flusher != nil {
+			s.flusher.Flush()
+		}
+	}
+}
+
+func (logger *Logger) Trace(format string, a ...interface{}) {
+	logger.doPrintf(traceLevel, printTraceLevel, format, a...)
+}
+
 func (logger *Logger) Debug(format string, a ...interface{}) {
 	logger.doPrintf(debugLevel, printDebugLevel, format, a...)
 }
@@ -123,6 +234,29 @@ func (logger *Logger) Fatal(format string, a ...interface{}) {
 	logger.doPrintf(fatalLevel, printFatalLevel, format, a...)
 }
 
+// the structured versions of Debug, Release, Error and Fatal take a message
+// and key/value pairs, e.g. Debugw("player login", "id", id, "module", "game")
+
+func (logger *Logger) Tracew(msg string, keysAndValues ...interface{}) {
+	logger.doPrintw(traceLevel, printTraceLevel, msg, keysAndValues)
+}
+
+func (logger *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	logger.doPrintw(debugLevel, printDebugLevel, msg, keysAndValues)
+}
+
+func (logger *Logger) Releasew(msg string, keysAndValues ...interface{}) {
+	logger.doPrintw(releaseLevel, printReleaseLevel, msg, keysAndValues)
+}
+
+func (logger *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	logger.doPrintw(errorLevel, printErrorLevel, msg, keysAndValues)
+}
+
+func (logger *Logger) Fatalw(msg string, keysAndValues ...interface{}) {
+	logger.doPrintw(fatalLevel, printFatalLevel, msg, keysAndValues)
+}
+
 var gLogger, _ = New("debug", "", log.LstdFlags)
 
 // It's dangerous to call the method on logging
@@ -132,6 +266,40 @@ func Export(logger *Logger) {
 	}
 }
 
+// goroutine safe
+func SetLevel(strLevel string) error {
+	return gLogger.SetLevel(strLevel)
+}
+
+// goroutine safe
+func Level() string {
+	return gLogger.Level()
+}
+
+// goroutine safe
+func SetDedup(window time.Duration) {
+	gLogger.SetDedup(window)
+}
+
+// goroutine safe
+func SetSampling(interval time.Duration, first int, thereafter int) {
+	gLogger.SetSampling(interval, first, thereafter)
+}
+
+// goroutine safe
+func SetPackageLevel(pkg string, strLevel string) error {
+	return gLogger.SetPackageLevel(pkg, strLevel)
+}
+
+// goroutine safe
+func PackageLevels() map[string]string {
+	return gLogger.PackageLevels()
+}
+
+func Trace(format string, a ...interface{}) {
+	gLogger.doPrintf(traceLevel, printTraceLevel, format, a...)
+}
+
 func Debug(format string, a ...interface{}) {
 	gLogger.doPrintf(debugLevel, printDebugLevel, format, a...)
 }
@@ -148,6 +316,36 @@ func Fatal(format string, a ...interface{}) {
 	gLogger.doPrintf(fatalLevel, printFatalLevel, format, a...)
 }
 
+// goroutine safe
+func SetFormat(format string) error {
+	return gLogger.SetFormat(format)
+}
+
+// a logger of the exported logger with the fields keysAndValues
+func With(keysAndValues ...interface{}) *Logger {
+	return gLogger.With(keysAndValues...)
+}
+
+func Tracew(msg string, keysAndValues ...interface{}) {
+	gLogger.doPrintw(traceLevel, printTraceLevel, msg, keysAndValues)
+}
+
+func Debugw(msg string, keysAndValues ...interface{}) {
+	gLogger.doPrintw(debugLevel, printDebugLevel, msg, keysAndValues)
+}
+
+func Releasew(msg string, keysAndValues ...interface{}) {
+	gLogger.doPrintw(releaseLevel, printReleaseLevel, msg, keysAndValues)
+}
+
+func Errorw(msg string, keysAndValues ...interface{}) {
+	gLogger.doPrintw(errorLevel, printErrorLevel, msg, keysAndValues)
+}
+
+func Fatalw(msg string, keysAndValues ...interface{}) {
+	gLogger.doPrintw(fatalLevel, printFatalLevel, msg, keysAndValues)
+}
+
 func Close() {
 	gLogger.Close()
 }
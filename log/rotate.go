@@ -0,0 +1,275 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// settings of a RotateWriter, zero values disable rotation and retention
+type RotateConfig struct {
+	// the directory of the log files
+	Path string
+	// rotate when the file would grow larger than MaxSize bytes
+	MaxSize int64
+	// rotate every Interval, aligned to the local time (e.g. at midnight for
+	// 24 * time.Hour)
+	Interval time.Duration
+	// keep at most MaxBackups rotated files
+	MaxBackups int
+	// remove the rotated files older than MaxAge
+	MaxAge time.Duration
+	// gzip the rotated files
+	Compress bool
+	// the prefix of the file names, e.g. game_ for game_20160102_15_04_05.log.
+	// Only the rotated files with the prefix are removed, the processes
+	// writing to the same directory must use different prefixes
+	Prefix string
+}
+
+// RotateWriter writes to a file named after the time it was created in
+// RotateConfig.Path, e.g. 20160102_15_04_05.log with no Prefix, and starts a
+// new file on rotation. The rotated files are compressed and removed in the
+// background
+type RotateWriter struct {
+	config     RotateConfig
+	mutex      sync.Mutex
+	file       *os.File
+	name       string
+	size       int64
+	rotateTime time.Time
+	wg         sync.WaitGroup
+	mutexClean sync.Mutex
+}
+
+// the name of a file after the prefix: the time and the number of the file
+// in the second
+var logFileName = regexp.MustCompile(`^(\d{8}_\d{2}_\d{2}_\d{2})(?:_(\d+))?\.log(?:\.gz)?$`)
+
+func NewRotateWriter(config RotateConfig) (*RotateWriter, error) {
+	if config.MaxSize < 0 || config.Interval < 0 || config.MaxBackups < 0 || config.MaxAge < 0 {
+		return nil, errors.New("invalid rotate config: negative limit")
+	}
+	if strings.ContainsAny(config.Prefix, `/\`) {
+		return nil, errors.New("invalid rotate config: path separator in prefix")
+	}
+
+	w := new(RotateWriter)
+	w.config = config
+	err := w.open(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotateWriter) open(now time.Time) error {
+	name := fmt.Sprintf("%v%d%02d%02d_%02d_%02d_%02d",
+		w.config.Prefix,
+		now.Year(),
+		now.Month(),
+		now.Day(),
+		now.Hour(),
+		now.Minute(),
+		now.Second())
+
+	// several rotations in a second
+	filename := path.Join(w.config.Path, name+".log")
+	for i := 1; exists(filename) || exists(filename+".gz"); i++ {
+		filename = path.Join(w.config.Path, fmt.Sprintf("%v_%d.log", name, i))
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.name = filename
+	w.size = 0
+	if w.config.Interval > 0 {
+		_, offset := now.Zone()
+		d := time.Duration(offset) * time.Second
+		w.rotateTime = now.Add(d).Truncate(w.config.Interval).Add(w.config.Interval).Add(-d)
+	}
+	return nil
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return !os.IsNotExist(err)
+}
+
+// the name of the current file, or of the last file once closed
+// goroutine safe
+func (w *RotateWriter) Name() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.name
+}
+
+// goroutine safe
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return 0, errors.New("rotate writer closed")
+	}
+
+	now := time.Now()
+	if w.size > 0 && w.config.MaxSize > 0 && w.size+int64(len(p)) > w.config.MaxSize ||
+		w.config.Interval > 0 && !now.Before(w.rotateTime) {
+		err := w.rotate(now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate starts a new file
+// goroutine safe
+func (w *RotateWriter) Rotate() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return errors.New("rotate writer closed")
+	}
+	return w.rotate(time.Now())
+}
+
+func (w *RotateWriter) rotate(now time.Time) error {
+	old := w.file
+	err := w.open(now)
+	if err != nil {
+		return err
+	}
+	old.Close()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		w.mutexClean.Lock()
+		defer w.mutexClean.Unlock()
+
+		if w.config.Compress {
+			err := compress(old.Name())
+			if err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "log: compress %v error: %v\n", old.Name(), err)
+			}
+		}
+		w.clean()
+	}()
+
+	return nil
+}
+
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(name + ".gz.tmp")
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(dst)
+	_, err = io.Copy(gw, src)
+	if err == nil {
+		err = gw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+
+	err = os.Rename(dst.Name(), name+".gz")
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// removes the rotated files with the prefix beyond MaxBackups or older than
+// MaxAge, a rotated file may be removed before it is compressed
+func (w *RotateWriter) clean() {
+	if w.config.MaxBackups == 0 && w.config.MaxAge == 0 {
+		return
+	}
+
+	infos, err := ioutil.ReadDir(w.config.Path)
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		info os.FileInfo
+		time string
+		seq  int
+	}
+	current := path.Base(w.Name())
+	var backups []backup
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || name == current || !strings.HasPrefix(name, w.config.Prefix) {
+			continue
+		}
+		m := logFileName.FindStringSubmatch(name[len(w.config.Prefix):])
+		if m == nil {
+			continue
+		}
+		seq, _ := strconv.Atoi(m[2])
+		backups = append(backups, backup{info, m[1], seq})
+	}
+
+	// the newest first
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].time != backups[j].time {
+			return backups[i].time > backups[j].time
+		}
+		return backups[i].seq > backups[j].seq
+	})
+
+	for i, b := range backups {
+		if w.config.MaxBackups > 0 && i >= w.config.MaxBackups ||
+			w.config.MaxAge > 0 && time.Since(b.info.ModTime()) > w.config.MaxAge {
+			os.Remove(path.Join(w.config.Path, b.info.Name()))
+		}
+	}
+}
+
+// Close closes the current file and waits for the compression and removal
+// of the rotated files
+func (w *RotateWriter) Close() error {
+	w.mutex.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mutex.Unlock()
+
+	w.wg.Wait()
+	return err
+}
@@ -0,0 +1,69 @@
+package log_test
+
+import (
+	"github.com/name5566/leaf/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRotateClean(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// older files of the server, and files of other servers
+	for _, name := range []string{
+		"game_20160102_15_04_05.log",
+		"game_20160102_15_04_05_2.log.gz",
+		"game_20160102_15_04_05_10.log",
+		"20160101_15_04_05.log",
+		"gate_20160101_15_04_05.log",
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := log.NewRotateWriter(log.RotateConfig{
+		Path:       dir,
+		MaxBackups: 2,
+		Prefix:     "game_",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := filepath.Base(w.Name())
+	err = w.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := filepath.Base(w.Name())
+	w.Close()
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	expected := []string{
+		current,
+		first,
+		"game_20160102_15_04_05_10.log",
+		"20160101_15_04_05.log",
+		"gate_20160101_15_04_05.log",
+	}
+	sort.Strings(expected)
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Fatalf("files %v, expected %v", names, expected)
+	}
+}
@@ -0,0 +1,232 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// limits the lines of a logger, fatal lines are never limited
+type limiter struct {
+	// duplicate suppression
+	window time.Duration
+	dups   map[dupKey]*dup
+
+	// sampling per call site
+	interval   time.Duration
+	first      int
+	thereafter int
+	sites      map[uintptr]*site
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// a line at its call site: the level, the formatted message and the fields
+type dupKey struct {
+	level int32
+	pc    uintptr
+	line  string
+}
+
+type dup struct {
+	count int
+	timer *time.Timer
+}
+
+type site struct {
+	start time.Time
+	count int
+}
+
+// SetDedup suppresses the repeats of a line logged again within window of
+// its first occurrence, and logs "message X repeated N times in T" at the end
+// of the window instead. A repeat is an identical line (level, formatted
+// message and fields) logged by the same call site. 0 disables the
+// suppression
+// goroutine safe
+func (logger *Logger) SetDedup(window time.Duration) {
+	logger.mutexLimiter.Lock()
+	defer logger.mutexLimiter.Unlock()
+
+	old := logger.loadLimiter()
+	l := newLimiter(old)
+	l.window = window
+	logger.storeLimiter(old, l)
+}
+
+// SetSampling limits the lines of every call site in each interval to the
+// first ones and then every thereafter-th one (none if thereafter is 0).
+// interval 0 disables the sampling
+// goroutine safe
+func (logger *Logger) SetSampling(interval time.Duration, first int, thereafter int) {
+	logger.mutexLimiter.Lock()
+	defer logger.mutexLimiter.Unlock()
+
+	old := logger.loadLimiter()
+	l := newLimiter(old)
+	l.interval = interval
+	l.first = first
+	l.thereafter = thereafter
+	logger.storeLimiter(old, l)
+}
+
+func newLimiter(old *limiter) *limiter {
+	l := new(limiter)
+	if old != nil {
+		l.window = old.window
+		l.interval = old.interval
+		l.first = old.first
+		l.thereafter = old.thereafter
+	}
+	l.dups = make(map[dupKey]*dup)
+	l.sites = make(map[uintptr]*site)
+	return l
+}
+
+func (logger *Logger) loadLimiter() *limiter {
+	l, _ := logger.limiter.Load().(*limiter)
+	return l
+}
+
+// you must hold mutexLimiter
+func (logger *Logger) storeLimiter(old *limiter, l *limiter) {
+	if l.window <= 0 && l.interval <= 0 {
+		l = nil
+	}
+	logger.limiter.Store(l)
+	if old != nil {
+		old.close(logger)
+	}
+}
+
+// whether a line of level logged by the caller at calldepth passes the limits
+func (logger *Logger) allow(level int32, msg string, keysAndValues []interface{}, calldepth int) bool {
+	l := logger.loadLimiter()
+	if l == nil || level == fatalLevel {
+		return true
+	}
+
+	var pcs [1]uintptr
+	if runtime.Callers(calldepth+1, pcs[:]) == 0 {
+		return true
+	}
+
+	if l.window > 0 {
+		line := msg + formatText(logger.fields) + formatText(keysAndValues)
+		if !l.firstOccurrence(logger, dupKey{level, pcs[0], line}) {
+			return false
+		}
+	}
+
+	if l.interval > 0 {
+		return l.sample(pcs[0])
+	}
+	return true
+}
+
+// whether the line is the first occurrence in its window
+func (l *limiter) firstOccurrence(logger *Logger, key dupKey) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return true
+	}
+
+	if d, ok := l.dups[key]; ok {
+		d.count++
+		return false
+	}
+
+	d := new(dup)
+	d.timer = time.AfterFunc(l.window, func() {
+		l.mutex.Lock()
+		if l.dups[key] != d {
+			l.mutex.Unlock()
+			return
+		}
+		delete(l.dups, key)
+		l.mutex.Unlock()
+
+		// Close and SetDedup hold the lock while they report
+		logger.mutexLimiter.Lock()
+		defer logger.mutexLimiter.Unlock()
+		l.report(logger, key, d)
+	})
+	l.dups[key] = d
+	return true
+}
+
+// written for the call site of the line
+// you must hold mutexLimiter
+func (l *limiter) report(logger *Logger, key dupKey, d *dup) {
+	if d.count == 0 || logger.sinks == nil {
+		return
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{key.pc}).Next()
+	logger.outputAt(frame.File, frame.Line, key.level, printLevel(key.level),
+		fmt.Sprintf("message %q repeated %v times in %v", key.line, d.count, l.window))
+}
+
+func (l *limiter) sample(pc uintptr) bool {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	s := l.sites[pc]
+	if s == nil || now.Sub(s.start) >= l.interval {
+		if s == nil {
+			s = new(site)
+			l.sites[pc] = s
+		}
+		s.start = now
+		s.count = 0
+	}
+	s.count++
+
+	if s.count <= l.first {
+		return true
+	}
+	return l.thereafter > 0 && (s.count-l.first)%l.thereafter == 0
+}
+
+// reports the pending repeats
+func (l *limiter) close(logger *Logger) {
+	l.mutex.Lock()
+	l.closed = true
+	dups := l.dups
+	l.dups = nil
+	l.mutex.Unlock()
+
+	keys := make([]dupKey, 0, len(dups))
+	for key := range dups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].line < keys[j].line
+	})
+	for _, key := range keys {
+		d := dups[key]
+		if d.timer.Stop() {
+			l.report(logger, key, d)
+		}
+	}
+}
+
+func printLevel(level int32) string {
+	switch level {
+	case traceLevel:
+		return printTraceLevel
+	case debugLevel:
+		return printDebugLevel
+	case releaseLevel:
+		return printReleaseLevel
+	case errorLevel:
+		return printErrorLevel
+	default:
+		return printFatalLevel
+	}
+}
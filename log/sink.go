@@ -0,0 +1,83 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+)
+
+// an output of a Logger
+type Sink struct {
+	// the lowest level written to the sink (default: trace), the level of
+	// the logger applies first
+	Level string
+	// text (default) or json
+	Format string
+	// the flag of the standard logger, see https://golang.org/pkg/log/#pkg-constants
+	Flag int
+	// os.Stdout if nil, closed with the logger if it is an io.Closer other
+	// than os.Stdout and os.Stderr, flushed before exiting on fatal level if
+	// it has a method Flush() error (e.g. an AsyncWriter)
+	Writer io.Writer
+}
+
+type flusher interface {
+	Flush() error
+}
+
+func closerOf(w io.Writer) io.Closer {
+	if c, ok := w.(io.Closer); ok && w != os.Stdout && w != os.Stderr {
+		return c
+	}
+	return nil
+}
+
+// NewSinks creates a logger writing every line to all the sinks, e.g. to
+// os.Stdout from release level and to a RotateWriter
+func NewSinks(strLevel string, sinks ...Sink) (*Logger, error) {
+	// level
+	level, err := parseLevel(strLevel)
+	if err != nil {
+		return nil, err
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("no sink")
+	}
+
+	// new
+	logger := new(Logger)
+	logger.core = new(core)
+	logger.level = level
+	logger.minLevel = level
+	for _, s := range sinks {
+		w := s.Writer
+		if w == nil {
+			w = os.Stdout
+		}
+
+		sk := new(sink)
+		sk.level = traceLevel
+		if s.Level != "" {
+			sk.level, err = parseLevel(s.Level)
+			if err != nil {
+				return nil, err
+			}
+		}
+		format, err := parseFormat(s.Format)
+		if err != nil {
+			return nil, err
+		}
+		sk.flag = s.Flag
+		sk.baseLogger = log.New(w, "", s.Flag)
+		sk.siteLogger = log.New(w, "", s.Flag&^(log.Lshortfile|log.Llongfile))
+		sk.setFormat(format)
+		sk.closer = closerOf(w)
+		if f, ok := w.(flusher); ok {
+			sk.flusher = f
+		}
+		logger.sinks = append(logger.sinks, sk)
+	}
+
+	return logger, nil
+}
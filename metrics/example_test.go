@@ -0,0 +1,39 @@
+package metrics_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/name5566/leaf/metrics"
+	"strings"
+)
+
+func Example() {
+	logins := metrics.NewCounter("game_logins_total", "Logins by platform.", "platform")
+	online := metrics.NewGauge("game_players_online", "Players online.")
+	rounds := metrics.NewHistogram("game_round_seconds", "Durations of the rounds.", []float64{60, 300})
+
+	logins.Inc("ios")
+	logins.Inc("android")
+	logins.Inc("ios")
+	online.Set(2)
+	rounds.Observe(42)
+	rounds.Observe(240)
+
+	var buf bytes.Buffer
+	metrics.WriteText(&buf)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "game_") {
+			fmt.Println(line)
+		}
+	}
+
+	// Output:
+	// game_logins_total{platform="android"} 1
+	// game_logins_total{platform="ios"} 2
+	// game_players_online 2
+	// game_round_seconds_bucket{le="60"} 1
+	// game_round_seconds_bucket{le="300"} 2
+	// game_round_seconds_bucket{le="+Inf"} 2
+	// game_round_seconds_sum 282
+	// game_round_seconds_count 2
+}
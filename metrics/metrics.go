@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// the kinds of metrics, as written in the # TYPE lines
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// a metric family: a name, a help text and the series of its label values
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	// the series, by label values joined with labelSep
+	mutex  sync.RWMutex
+	series map[string]*series
+
+	// a histogram
+	buckets []float64
+
+	// collected when written
+	collect func(set func(value float64, labelValues ...string))
+}
+
+type series struct {
+	labelValues []string
+	// a float64
+	value uint64
+
+	// a histogram
+	counts []uint64
+	count  uint64
+}
+
+const labelSep = "\xff"
+
+var (
+	families      = make(map[string]*family)
+	mutexFamilies sync.Mutex
+)
+
+func register(f *family) {
+	for _, l := range f.labels {
+		if !validName(l) || l == "le" {
+			panic(fmt.Sprintf("metric %v: invalid label name %q", f.name, l))
+		}
+	}
+	if !validName(f.name) {
+		panic(fmt.Sprintf("invalid metric name %q", f.name))
+	}
+	f.series = make(map[string]*series)
+
+	mutexFamilies.Lock()
+	defer mutexFamilies.Unlock()
+	if _, ok := families[f.name]; ok {
+		panic(fmt.Sprintf("metric %v: already registered", f.name))
+	}
+	families[f.name] = f
+
+	// written as zero before the first use
+	if len(f.labels) == 0 && f.collect == nil {
+		f.get(nil)
+	}
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && r != ':' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') &&
+			(i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// the series of labelValues, created on first use
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %v: %v label values for labels %v", f.name, len(labelValues), f.labels))
+	}
+	key := strings.Join(labelValues, labelSep)
+
+	f.mutex.RLock()
+	s := f.series[key]
+	f.mutex.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s = f.series[key]
+	if s == nil {
+		s = new(series)
+		s.labelValues = append([]string(nil), labelValues...)
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (s *series) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&s.value)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&s.value, old, n) {
+			return
+		}
+	}
+}
+
+func (s *series) set(v float64) {
+	atomic.StoreUint64(&s.value, math.Float64bits(v))
+}
+
+func (s *series) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.value))
+}
+
+// Counter is a value which only goes up, e.g. the number of messages
+// received. The label values are passed to every call in the order of the
+// labels given to NewCounter
+type Counter struct {
+	f *family
+}
+
+// NewCounter registers a counter, it panics if the name is already taken
+func NewCounter(name string, help string, labels ...string) *Counter {
+	f := &family{name: name, help: help, kind: kindCounter, labels: labels}
+	register(f)
+	return &Counter{f}
+}
+
+// goroutine safe
+func (c *Counter) Inc(labelValues ...string) {
+	c.f.get(labelValues).add(1)
+}
+
+// v must not be negative
+// goroutine safe
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metric %v: counter decreased by %v", c.f.name, v))
+	}
+	c.f.get(labelValues).add(v)
+}
+
+// Gauge is a value which goes up and down, e.g. the number of players online
+type Gauge struct {
+	f *family
+}
+
+// NewGauge registers a gauge, it panics if the name is already taken
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	f := &family{name: name, help: help, kind: kindGauge, labels: labels}
+	register(f)
+	return &Gauge{f}
+}
+
+// goroutine safe
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.get(labelValues).set(v)
+}
+
+// goroutine safe
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.get(labelValues).add(v)
+}
+
+// goroutine safe
+func (g *Gauge) Inc(labelValues ...string) {
+	g.f.get(labelValues).add(1)
+}
+
+// goroutine safe
+func (g *Gauge) Dec(labelValues ...string) {
+	g.f.get(labelValues).add(-1)
+}
+
+// NewGaugeFunc registers a gauge read when the metrics are written: collect
+// calls set for every series, e.g. once per module with the length of its
+// queue. collect must be goroutine safe
+func NewGaugeFunc(name string, help string, labels []string, collect func(set func(value float64, labelValues ...string))) {
+	f := &family{name: name, help: help, kind: kindGauge, labels: labels, collect: collect}
+	register(f)
+}
+
+// NewCounterFunc is NewGaugeFunc for a value which only goes up
+func NewCounterFunc(name string, help string, labels []string, collect func(set func(value float64, labelValues ...string))) {
+	f := &family{name: name, help: help, kind: kindCounter, labels: labels, collect: collect}
+	register(f)
+}
+
+// the default buckets of a histogram, for durations in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations, e.g. durations, in buckets
+type Histogram struct {
+	f *family
+}
+
+// NewHistogram registers a histogram with the upper bounds of its buckets
+// (DefBuckets if nil), it panics if the name is already taken
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+
+	f := &family{name: name, help: help, kind: kindHistogram, labels: labels, buckets: buckets}
+	register(f)
+	return &Histogram{f}
+}
+
+// goroutine safe
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	s := h.f.get(labelValues)
+	i := sort.SearchFloat64s(h.f.buckets, v)
+	if i < len(s.counts) {
+		atomic.AddUint64(&s.counts[i], 1)
+	}
+	atomic.AddUint64(&s.count, 1)
+	s.add(v)
+}
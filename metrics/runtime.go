@@ -0,0 +1,18 @@
+package metrics
+
+import (
+	"runtime"
+)
+
+func init() {
+	NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", nil,
+		func(set func(value float64, labelValues ...string)) {
+			set(float64(runtime.NumGoroutine()))
+		})
+	NewGaugeFunc("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", nil,
+		func(set func(value float64, labelValues ...string)) {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			set(float64(m.HeapAlloc))
+		})
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"bufio"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var server *http.Server
+
+// Init serves the metrics at http://conf.MetricsAddr/metrics
+func Init() {
+	InitConfig(conf.Default())
+}
+
+// InitConfig serves the metrics at http://c.MetricsAddr/metrics
+func InitConfig(c *conf.Config) {
+	if c.MetricsAddr == "" {
+		return
+	}
+
+	ln, err := net.Listen("tcp", c.MetricsAddr)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	go func() {
+		err := server.Serve(ln)
+		if err != http.ErrServerClosed {
+			log.Error("metrics: HTTP server error: %v", err)
+		}
+	}()
+}
+
+func Destroy() {
+	if server != nil {
+		server.Close()
+	}
+}
+
+// Handler writes the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteText(w)
+	})
+}
+
+// WriteText writes the metrics in the Prometheus text format, sorted by name
+// goroutine safe
+func WriteText(w io.Writer) error {
+	mutexFamilies.Lock()
+	fs := make([]*family, 0, len(families))
+	for _, f := range families {
+		fs = append(fs, f)
+	}
+	mutexFamilies.Unlock()
+	sort.Slice(fs, func(i, j int) bool {
+		return fs[i].name < fs[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range fs {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	type sample struct {
+		labelValues []string
+		s           *series
+		value       float64
+	}
+	var samples []sample
+	if f.collect != nil {
+		f.collect(func(value float64, labelValues ...string) {
+			if len(labelValues) != len(f.labels) {
+				log.Error("metric %v: %v label values for labels %v", f.name, len(labelValues), f.labels)
+				return
+			}
+			samples = append(samples, sample{labelValues: labelValues, value: value})
+		})
+	} else {
+		f.mutex.RLock()
+		for _, s := range f.series {
+			samples = append(samples, sample{labelValues: s.labelValues, s: s, value: s.load()})
+		}
+		f.mutex.RUnlock()
+	}
+	if len(samples) == 0 {
+		return
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].labelValues, labelSep) < strings.Join(samples[j].labelValues, labelSep)
+	})
+
+	w.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+	for _, sample := range samples {
+		labels := f.labelPairs(sample.labelValues)
+		if f.kind != kindHistogram {
+			writeSample(w, f.name, labels, "", sample.value)
+			continue
+		}
+
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += atomic.LoadUint64(&sample.s.counts[i])
+			writeSample(w, f.name+"_bucket", labels, `le="`+formatFloat(bound)+`"`, float64(cumulative))
+		}
+		count := atomic.LoadUint64(&sample.s.count)
+		writeSample(w, f.name+"_bucket", labels, `le="+Inf"`, float64(count))
+		writeSample(w, f.name+"_sum", labels, "", sample.value)
+		writeSample(w, f.name+"_count", labels, "", float64(count))
+	}
+}
+
+func (f *family) labelPairs(labelValues []string) string {
+	pairs := make([]string, len(f.labels))
+	for i, l := range f.labels {
+		pairs[i] = l + `="` + escapeLabel(labelValues[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func writeSample(w *bufio.Writer, name string, labels string, extra string, value float64) {
+	w.WriteString(name)
+	if extra != "" {
+		if labels != "" {
+			labels += ","
+		}
+		labels += extra
+	}
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,68 @@
+package module_test
+
+import (
+	"fmt"
+	"github.com/name5566/leaf/module"
+)
+
+type Mod struct {
+	name string
+	deps []string
+}
+
+func (m *Mod) Name() string {
+	return m.name
+}
+
+func (m *Mod) DependsOn() []string {
+	return m.deps
+}
+
+func (m *Mod) OnInit() {
+	fmt.Println("init", m.name)
+}
+
+func (m *Mod) OnDestroy() {
+	fmt.Println("destroy", m.name)
+}
+
+func (m *Mod) Run(closeSig chan bool) {
+	<-closeSig
+}
+
+func Example() {
+	module.Register(&Mod{name: "game", deps: []string{"db"}})
+	module.Register(&Mod{name: "gate", deps: []string{"game"}})
+	module.Register(&Mod{name: "db"})
+
+	err := module.Init()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	state, _ := module.StateOf("game")
+	fmt.Println(state)
+
+	fmt.Println(module.Stop("game"))
+	fmt.Println(module.Restart("gate"))
+
+	module.Destroy()
+
+	state, _ = module.StateOf("game")
+	fmt.Println(state)
+
+	// Output:
+	// init db
+	// init game
+	// init gate
+	// running
+	// module game: required by running modules gate
+	// destroy gate
+	// init gate
+	// <nil>
+	// destroy gate
+	// destroy game
+	// destroy db
+	// stopped
+}
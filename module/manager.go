@@ -0,0 +1,228 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"github.com/name5566/leaf/console"
+	"github.com/name5566/leaf/log"
+	"strings"
+)
+
+var initialized bool
+
+func init() {
+	console.RegisterFunc("module", "starts, stops or restarts a module", commandModule)
+	console.SetCompleter("module", completeModule)
+}
+
+func find(name string) (*module, error) {
+	mutexState.RLock()
+	defer mutexState.RUnlock()
+
+	var found *module
+	for _, m := range mods {
+		if m.name != name {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("module %v: already registered", name)
+		}
+		found = m
+	}
+	if found == nil {
+		return nil, fmt.Errorf("module %v: not registered", name)
+	}
+	return found, nil
+}
+
+// starts a module registered after Init or stopped by Stop, OnInit is called
+// again and must prepare the module to run again
+// goroutine safe
+func Start(name string) error {
+	mutexManage.Lock()
+	defer mutexManage.Unlock()
+
+	return start(name)
+}
+
+// stops a running module, no running module may depend on it
+// goroutine safe
+func Stop(name string) error {
+	mutexManage.Lock()
+	defer mutexManage.Unlock()
+
+	return stopByName(name)
+}
+
+// goroutine safe
+func Restart(name string) error {
+	mutexManage.Lock()
+	defer mutexManage.Unlock()
+
+	err := stopByName(name)
+	if err != nil {
+		return err
+	}
+	return start(name)
+}
+
+func start(name string) error {
+	if !initialized {
+		return errors.New("modules not running")
+	}
+
+	m, err := find(name)
+	if err != nil {
+		return err
+	}
+	state := m.getState()
+	if state != StateRegistered && state != StateStopped {
+		return fmt.Errorf("module %v: could not start a module in state %v", name, state)
+	}
+	for _, dep := range m.deps {
+		d, err := find(dep)
+		if err != nil {
+			return fmt.Errorf("module %v: depends on unknown module %v", name, dep)
+		}
+		if s := d.getState(); s != StateRunning {
+			return fmt.Errorf("module %v: depends on module %v in state %v", name, dep, s)
+		}
+	}
+
+	// started again after being stopped
+	r, reopened := m.mi.(interface {
+		reopen()
+		reclose()
+	})
+	if reopened {
+		r.reopen()
+	}
+	m.setState(StateInitializing)
+	err = initModule(m)
+	if err != nil {
+		if reopened {
+			r.reclose()
+		}
+		m.setState(StateStopped)
+		return fmt.Errorf("module %v: init error: %v", name, err)
+	}
+	launch(m)
+
+	log.Release("module %v started", name)
+	return nil
+}
+
+func stopByName(name string) error {
+	if !initialized {
+		return errors.New("modules not running")
+	}
+
+	m, err := find(name)
+	if err != nil {
+		return err
+	}
+	if s := m.getState(); s != StateRunning {
+		return fmt.Errorf("module %v: could not stop a module in state %v", name, s)
+	}
+	if dependents := runningDependents(name); len(dependents) > 0 {
+		return fmt.Errorf("module %v: required by running modules %v",
+			name, strings.Join(dependents, ", "))
+	}
+
+	stop(m)
+
+	log.Release("module %v stopped", name)
+	return nil
+}
+
+func runningDependents(name string) []string {
+	mutexState.RLock()
+	defer mutexState.RUnlock()
+
+	var dependents []string
+	for _, m := range mods {
+		if m.state != StateRunning {
+			continue
+		}
+		for _, dep := range m.deps {
+			if dep == name {
+				dependents = append(dependents, m.name)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// console command
+func commandModuleUsage() string {
+	return "module manages the modules of the running server\r\n\r\n" +
+		"Usage: module list|status|start|stop|restart\r\n" +
+		"  list           - lists the modules and their states\r\n" +
+		"  status         - shows the queues of the modules\r\n" +
+		"  start name     - initializes and runs a registered or stopped module\r\n" +
+		"  stop name      - stops and destroys a running module\r\n" +
+		"  restart name   - stops and starts a running module"
+}
+
+func completeModule(args []string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"list", "status", "start", "stop", "restart"}
+	case len(args) == 1 && args[0] != "list" && args[0] != "status":
+		mutexState.RLock()
+		defer mutexState.RUnlock()
+
+		var names []string
+		for _, m := range mods {
+			names = append(names, m.name)
+		}
+		return names
+	default:
+		return nil
+	}
+}
+
+func commandModule(args []string) string {
+	if len(args) == 0 {
+		return commandModuleUsage()
+	}
+
+	if args[0] == "list" {
+		mutexState.RLock()
+		defer mutexState.RUnlock()
+
+		var lines []string
+		for _, m := range mods {
+			line := m.name + " - " + m.state.String()
+			if len(m.deps) > 0 {
+				line += " (depends on " + strings.Join(m.deps, ", ") + ")"
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\r\n")
+	}
+	if args[0] == "status" {
+		return commandModuleStatus()
+	}
+
+	if len(args) != 2 {
+		return commandModuleUsage()
+	}
+
+	var err error
+	switch args[0] {
+	case "start":
+		err = Start(args[1])
+	case "stop":
+		err = Stop(args[1])
+	case "restart":
+		err = Restart(args[1])
+	default:
+		return commandModuleUsage()
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
@@ -0,0 +1,70 @@
+package module
+
+import (
+	"github.com/name5566/leaf/metrics"
+)
+
+func init() {
+	metrics.NewGaugeFunc("leaf_module_queue_length", "Items waiting in the queues of the module skeletons.",
+		[]string{"module", "queue"},
+		func(set func(value float64, labelValues ...string)) {
+			for _, s := range ModuleStats() {
+				if s.Skeleton {
+					set(float64(s.ChanCall.Len), s.Name, "chanrpc")
+					set(float64(s.ChanCommand.Len), s.Name, "command")
+					set(float64(s.ChanTimer.Len), s.Name, "timer")
+					set(float64(s.ChanCb.Len), s.Name, "go")
+					set(float64(s.ChanAsynRet.Len), s.Name, "asyncall")
+				}
+			}
+		})
+	metrics.NewGaugeFunc("leaf_module_queue_capacity", "Capacity of the queues of the module skeletons.",
+		[]string{"module", "queue"},
+		func(set func(value float64, labelValues ...string)) {
+			for _, s := range ModuleStats() {
+				if s.Skeleton {
+					set(float64(s.ChanCall.Cap), s.Name, "chanrpc")
+					set(float64(s.ChanCommand.Cap), s.Name, "command")
+					set(float64(s.ChanTimer.Cap), s.Name, "timer")
+					set(float64(s.ChanCb.Cap), s.Name, "go")
+					set(float64(s.ChanAsynRet.Cap), s.Name, "asyncall")
+				}
+			}
+		})
+	metrics.NewGaugeFunc("leaf_module_pending_go", "Go calls of the module skeletons whose callback has not run.",
+		[]string{"module"},
+		func(set func(value float64, labelValues ...string)) {
+			for _, s := range ModuleStats() {
+				if s.Skeleton {
+					set(float64(s.PendingGo), s.Name)
+				}
+			}
+		})
+	metrics.NewGaugeFunc("leaf_module_pending_asyncall", "AsynCall calls of the module skeletons whose callback has not run.",
+		[]string{"module"},
+		func(set func(value float64, labelValues ...string)) {
+			for _, s := range ModuleStats() {
+				if s.Skeleton {
+					set(float64(s.PendingAsynCall), s.Name)
+				}
+			}
+		})
+	metrics.NewGaugeFunc("leaf_module_running", "Whether the module is running.",
+		[]string{"module"},
+		func(set func(value float64, labelValues ...string)) {
+			for _, s := range ModuleStats() {
+				running := 0.0
+				if s.State == StateRunning {
+					running = 1
+				}
+				set(running, s.Name)
+			}
+		})
+	metrics.NewCounterFunc("leaf_module_stalls_total", "Stalls of the module goroutines reported by the watchdog.",
+		[]string{"module"},
+		func(set func(value float64, labelValues ...string)) {
+			for _, s := range WatchdogStats() {
+				set(float64(s.Stalls), s.Name)
+			}
+		})
+}
@@ -1,10 +1,15 @@
 package module
 
 import (
+	"errors"
+	"fmt"
 	"github.com/name5566/leaf/conf"
 	"github.com/name5566/leaf/log"
+	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Module interface {
@@ -13,41 +18,230 @@ type Module interface {
 	Run(closeSig chan bool)
 }
 
+// optional, the name used by other modules to depend on the module
+// (default: the type name of the module, e.g. game.Module)
+type Named interface {
+	Name() string
+}
+
+// optional, the names of the modules which must be initialized before
+// and destroyed after the module
+type Dependent interface {
+	DependsOn() []string
+}
+
 type module struct {
 	mi       Module
+	name     string
+	deps     []string
+	state    State
 	closeSig chan bool
 	wg       sync.WaitGroup
 }
 
-var mods []*module
+var (
+	mods        []*module
+	mutexState  sync.RWMutex
+	mutexManage sync.Mutex
+)
 
 func Register(mi Module) {
 	m := new(module)
 	m.mi = mi
-	m.closeSig = make(chan bool, 1)
+	m.name = nameOf(mi)
+	if d, ok := mi.(Dependent); ok {
+		m.deps = d.DependsOn()
+	}
+	m.state = StateRegistered
 
+	mutexState.Lock()
 	mods = append(mods, m)
+	mutexState.Unlock()
 }
 
-func Init() {
-	for i := 0; i < len(mods); i++ {
-		mods[i].mi.OnInit()
+func nameOf(mi Module) string {
+	if n, ok := mi.(Named); ok {
+		return n.Name()
+	}
+	return strings.TrimPrefix(reflect.TypeOf(mi).String(), "*")
+}
+
+// Init initializes and runs the registered modules with the settings of the
+// conf variables
+func Init() error {
+	return InitConfig(conf.Default())
+}
+
+// InitConfig initializes and runs the registered modules with the module
+// settings of c
+func InitConfig(c *conf.Config) error {
+	setStallThreshold(time.Duration(c.StallThreshold))
+
+	mutexManage.Lock()
+	defer mutexManage.Unlock()
+
+	sorted, err := sortMods(mods)
+	if err != nil {
+		return err
 	}
+	mutexState.Lock()
+	mods = sorted
+	mutexState.Unlock()
 
 	for i := 0; i < len(mods); i++ {
 		m := mods[i]
-		m.wg.Add(1)
-		go run(m)
+		m.setState(StateInitializing)
+		err := initModule(m)
+		if err == nil {
+			continue
+		}
+
+		// abort startup
+		m.setState(StateStopped)
+		for j := i - 1; j >= 0; j-- {
+			mods[j].setState(StateStopping)
+			destroy(mods[j])
+			mods[j].setState(StateStopped)
+		}
+		return fmt.Errorf("module %v: init error: %v", m.name, err)
 	}
+
+	for i := 0; i < len(mods); i++ {
+		launch(mods[i])
+	}
+	initialized = true
+
+	return nil
 }
 
 func Destroy() {
+	mutexManage.Lock()
+	defer mutexManage.Unlock()
+
+	initialized = false
 	for i := len(mods) - 1; i >= 0; i-- {
 		m := mods[i]
-		m.closeSig <- true
-		m.wg.Wait()
-		destroy(m)
+		if m.getState() == StateRunning {
+			stop(m)
+		}
+	}
+}
+
+// sortMods orders the modules so that every module comes after the modules it
+// depends on. Modules without a dependency between them keep the registration
+// order
+func sortMods(mods []*module) ([]*module, error) {
+	byName := make(map[string]*module)
+	for _, m := range mods {
+		if _, ok := byName[m.name]; ok {
+			return nil, fmt.Errorf("module %v: already registered", m.name)
+		}
+		byName[m.name] = m
+	}
+	for _, m := range mods {
+		for _, dep := range m.deps {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("module %v: depends on unknown module %v", m.name, dep)
+			}
+		}
+	}
+
+	sorted := make([]*module, 0, len(mods))
+	done := make(map[string]bool)
+	for len(sorted) < len(mods) {
+		progress := false
+		for _, m := range mods {
+			if done[m.name] || !depsDone(m, done) {
+				continue
+			}
+			done[m.name] = true
+			sorted = append(sorted, m)
+			progress = true
+			break
+		}
+		if !progress {
+			return nil, errors.New("dependency cycle: " + findCycle(mods, done, byName))
+		}
 	}
+
+	return sorted, nil
+}
+
+func depsDone(m *module, done map[string]bool) bool {
+	for _, dep := range m.deps {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle walks the dependencies of the modules left unsorted, all of which
+// are part of or lead to a cycle
+func findCycle(mods []*module, done map[string]bool, byName map[string]*module) string {
+	var m *module
+	for _, _m := range mods {
+		if !done[_m.name] {
+			m = _m
+			break
+		}
+	}
+
+	var path []string
+	visited := make(map[string]int)
+	for {
+		if i, ok := visited[m.name]; ok {
+			return strings.Join(append(path[i:], m.name), " -> ")
+		}
+		visited[m.name] = len(path)
+		path = append(path, m.name)
+
+		for _, dep := range m.deps {
+			if !done[dep] {
+				m = byName[dep]
+				break
+			}
+		}
+	}
+}
+
+func initModule(m *module) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	m.mi.OnInit()
+	return
+}
+
+func launch(m *module) {
+	if s, ok := m.mi.(interface {
+		setName(string)
+	}); ok {
+		s.setName(m.name)
+	}
+
+	m.closeSig = make(chan bool, 1)
+	m.setState(StateRunning)
+	m.wg.Add(1)
+	go run(m)
+}
+
+func stop(m *module) {
+	m.setState(StateStopping)
+	m.closeSig <- true
+	m.wg.Wait()
+	destroy(m)
+	m.setState(StateStopped)
 }
 
 func run(m *module) {
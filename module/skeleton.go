@@ -5,6 +5,7 @@ import (
 	"github.com/name5566/leaf/console"
 	"github.com/name5566/leaf/go"
 	"github.com/name5566/leaf/timer"
+	"github.com/name5566/leaf/tracing"
 	"time"
 )
 
@@ -18,6 +19,11 @@ type Skeleton struct {
 	client             *chanrpc.Client
 	server             *chanrpc.Server
 	commandServer      *chanrpc.Server
+	closed             bool
+	name               string
+	watchdog           *watchdog
+	// the span of the Go or AsynCall callback being run
+	span *tracing.Span
 }
 
 func (s *Skeleton) Init() {
@@ -43,6 +49,14 @@ func (s *Skeleton) Init() {
 }
 
 func (s *Skeleton) Run(closeSig chan bool) {
+	if getStallThreshold() > 0 {
+		s.watchdog = newWatchdog(s.name)
+		defer func() {
+			s.watchdog.close()
+			s.watchdog = nil
+		}()
+	}
+
 	for {
 		select {
 		case <-closeSig:
@@ -52,21 +66,71 @@ func (s *Skeleton) Run(closeSig chan bool) {
 				s.g.Close()
 				s.client.Close()
 			}
+			s.closed = true
 			return
 		case ri := <-s.client.ChanAsynRet:
+			s.begin("asyncall callback", nil)
+			s.span = ri.Span()
 			s.client.Cb(ri)
+			s.span = nil
+			s.end()
 		case ci := <-s.server.ChanCall:
+			s.begin("chanrpc", ci.ID())
 			s.server.Exec(ci)
+			s.end()
 		case ci := <-s.commandServer.ChanCall:
+			s.begin("command", ci.ID())
 			s.commandServer.Exec(ci)
+			s.end()
 		case cb := <-s.g.ChanCb:
+			if s.watchdog != nil {
+				s.begin("go callback", funcName(cb))
+			}
 			s.g.Cb(cb)
+			s.end()
 		case t := <-s.dispatcher.ChanTimer:
+			s.begin("timer", nil)
 			t.Cb()
+			s.end()
 		}
 	}
 }
 
+// called by Start before OnInit, the calls made to the module from then on
+// are queued until Run
+func (s *Skeleton) reopen() {
+	if s.closed {
+		s.server.Reopen()
+		s.commandServer.Reopen()
+		s.closed = false
+	}
+}
+
+// called by Start if OnInit fails after reopen
+func (s *Skeleton) reclose() {
+	if !s.closed {
+		s.commandServer.Close()
+		s.server.Close()
+		s.closed = true
+	}
+}
+
+func (s *Skeleton) setName(name string) {
+	s.name = name
+}
+
+func (s *Skeleton) begin(kind string, id interface{}) {
+	if s.watchdog != nil {
+		s.watchdog.begin(kind, id)
+	}
+}
+
+func (s *Skeleton) end() {
+	if s.watchdog != nil {
+		s.watchdog.end()
+	}
+}
+
 func (s *Skeleton) AfterFunc(d time.Duration, cb func()) *timer.Timer {
 	if s.TimerDispatcherLen == 0 {
 		panic("invalid TimerDispatcherLen")
@@ -83,12 +147,44 @@ func (s *Skeleton) CronFunc(cronExpr *timer.CronExpr, cb func()) *timer.Cron {
 	return s.dispatcher.CronFunc(cronExpr, cb)
 }
 
+// the span of the chanrpc call, Go callback or AsynCall callback being run,
+// nil if it is not traced. Go and AsynCall carry it on, and the game code
+// starts its own spans as children, e.g. for MongoDB queries
+// goroutine not safe (call it from the module)
+func (s *Skeleton) Span() *tracing.Span {
+	if span := s.server.Span(); span != nil {
+		return span
+	}
+	return s.span
+}
+
+// f runs in a child of the current span and cb in the current span
 func (s *Skeleton) Go(f func(), cb func()) {
 	if s.GoLen == 0 {
 		panic("invalid GoLen")
 	}
 
-	s.g.Go(f, cb)
+	span := s.Span()
+	if span == nil {
+		s.g.Go(f, cb)
+		return
+	}
+
+	name := "go " + funcName(f)
+	s.g.Go(func() {
+		goSpan := span.Child(name)
+		defer goSpan.End()
+		f()
+	}, func() {
+		if cb == nil {
+			return
+		}
+		s.span = span
+		defer func() {
+			s.span = nil
+		}()
+		cb()
+	})
 }
 
 func (s *Skeleton) NewLinearContext() *g.LinearContext {
@@ -105,6 +201,7 @@ func (s *Skeleton) AsynCall(server *chanrpc.Server, id interface{}, args ...inte
 	}
 
 	s.client.Attach(server)
+	s.client.SetSpan(s.Span())
 	s.client.AsynCall(id, args...)
 }
 
@@ -119,3 +216,12 @@ func (s *Skeleton) RegisterChanRPC(id interface{}, f interface{}) {
 func (s *Skeleton) RegisterCommand(name string, help string, f interface{}) {
 	console.Register(name, help, f, s.commandServer)
 }
+
+// RegisterStreamCommand registers a long running command, e.g. a data
+// migration, executed by the module goroutine like the commands registered by
+// RegisterCommand. f writes its output to s and closes s when the output
+// ends, it may return before and go on in steps (AfterFunc, Go), each step
+// checking whether s is cancelled. See console.RegisterExternalStream
+func (s *Skeleton) RegisterStreamCommand(name string, help string, f func(s *console.Stream, args []string)) {
+	console.RegisterExternalStream(name, help, f, s.commandServer)
+}
@@ -0,0 +1,300 @@
+package module
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/console"
+	"github.com/name5566/leaf/log"
+	stdlog "log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type restartModule struct {
+	*Skeleton
+	calls int32
+}
+
+func (m *restartModule) Name() string {
+	return "restart"
+}
+
+func (m *restartModule) OnInit() {}
+
+func (m *restartModule) OnDestroy() {}
+
+func TestRestartWhileCalled(t *testing.T) {
+	saved := mods
+	mods = nil
+	defer func() {
+		mods = saved
+		initialized = false
+	}()
+
+	m := new(restartModule)
+	m.Skeleton = &Skeleton{ChanRPCServer: chanrpc.NewServer(10)}
+	m.Skeleton.Init()
+	m.RegisterChanRPC("call", func(args []interface{}) {
+		atomic.AddInt32(&m.calls, 1)
+	})
+	Register(m)
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	closeSig := make(chan bool)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-closeSig:
+				return
+			default:
+				m.ChanRPCServer.Go("call")
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-closeSig:
+				return
+			default:
+				ModuleStats()
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		if err := Restart("restart"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := atomic.LoadInt32(&m.calls)
+	m.ChanRPCServer.Call0("call")
+	if atomic.LoadInt32(&m.calls) <= before {
+		t.Error("call not executed after restart")
+	}
+
+	close(closeSig)
+	wg.Wait()
+	Destroy()
+}
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestStreamCommand(t *testing.T) {
+	s := &Skeleton{TimerDispatcherLen: 10}
+	s.Init()
+	// migrate N writes a line per step on the module goroutine, one step
+	// every 10 ms, until N steps are done or the command is cancelled
+	s.RegisterStreamCommand("migrate", "migrate N", func(stream *console.Stream, args []string) {
+		n, _ := strconv.Atoi(args[0])
+		i := 0
+		var step func()
+		step = func() {
+			if stream.Cancelled() {
+				stream.Close()
+				return
+			}
+			if i == n {
+				stream.Println("done")
+				stream.Close()
+				return
+			}
+			stream.Printf("step %v", i)
+			i++
+			s.AfterFunc(10*time.Millisecond, step)
+		}
+		step()
+	})
+	// flood writes more lines at once than a client not reading can take
+	flooded := make(chan bool, 1)
+	s.RegisterStreamCommand("flood", "flood", func(stream *console.Stream, args []string) {
+		line := strings.Repeat("x", 1024)
+		for i := 0; i < 1<<16 && !stream.Cancelled(); i++ {
+			stream.Println(line)
+		}
+		flooded <- stream.Cancelled()
+		stream.Close()
+	})
+	closeSig := make(chan bool)
+	go s.Run(closeSig)
+	defer func() { closeSig <- true }()
+
+	savedPort, savedHTTPPort := conf.ConsolePort, conf.ConsoleHTTPPort
+	conf.ConsolePort, conf.ConsoleHTTPPort = freePort(t), freePort(t)
+	defer func() { conf.ConsolePort, conf.ConsoleHTTPPort = savedPort, savedHTTPPort }()
+	console.Init()
+	defer console.Destroy()
+
+	t.Run("telnet", func(t *testing.T) {
+		conn, err := net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(conf.ConsolePort)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		r := bufio.NewReader(conn)
+		readUntil := func(prefix string) {
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					t.Fatalf("reading %q: %v", prefix, err)
+				}
+				if i := strings.Index(line, prefix); i >= 0 {
+					return
+				}
+			}
+		}
+
+		conn.Write([]byte("migrate 1000\r\n"))
+		readUntil("step 3")
+		// telnet sends Ctrl-C as IAC IP
+		conn.Write([]byte{255, 244})
+		readUntil("cancelling migrate")
+		// written once the module goroutine closes the stream
+		readUntil("migrate cancelled")
+	})
+
+	t.Run("http", func(t *testing.T) {
+		url := "http://" + net.JoinHostPort("localhost", strconv.Itoa(conf.ConsoleHTTPPort)) + "/commands/migrate"
+		resp, err := http.Post(url, "application/json", strings.NewReader(`{"args": ["3"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Fatalf("Content-Type %q", ct)
+		}
+
+		var lines []string
+		d := json.NewDecoder(resp.Body)
+		for d.More() {
+			var l struct {
+				Line string `json:"line"`
+			}
+			if err := d.Decode(&l); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, l.Line)
+		}
+		if got := strings.Join(lines, ","); got != "step 0,step 1,step 2,done" {
+			t.Fatalf("lines %q", got)
+		}
+	})
+
+	t.Run("stalled client", func(t *testing.T) {
+		conn, err := net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(conf.ConsoleHTTPPort)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("POST /commands/flood HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\n\r\n"))
+
+		// the response is never read, the module goroutine must not block
+		select {
+		case cancelled := <-flooded:
+			if !cancelled {
+				t.Fatal("flood not cancelled")
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("module blocked by the client")
+		}
+		done := make(chan bool)
+		s.AfterFunc(0, func() { close(done) })
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("module blocked by the client")
+		}
+	})
+}
+
+// a goroutine safe log writer
+type logBuffer struct {
+	mutex sync.Mutex
+	buf   strings.Builder
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchdogStall(t *testing.T) {
+	output := new(logBuffer)
+	logger, err := log.NewSinks("release", log.Sink{Writer: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Export(logger)
+	defer func() {
+		logger, _ := log.New("debug", "", stdlog.LstdFlags)
+		log.Export(logger)
+	}()
+	setStallThreshold(100 * time.Millisecond)
+	defer setStallThreshold(0)
+
+	s := &Skeleton{ChanRPCServer: chanrpc.NewServer(10)}
+	s.Init()
+	s.setName("stall")
+	s.RegisterChanRPC("slow", func(args []interface{}) {
+		time.Sleep(500 * time.Millisecond)
+	})
+	s.RegisterChanRPC("fast", func(args []interface{}) {})
+	closeSig := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+
+	err = s.ChanRPCServer.Call0("slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the slow item has ended once the next one is executed
+	s.ChanRPCServer.Call0("fast")
+	stats := commandWatchdog(nil)
+	closeSig <- true
+	<-done
+
+	// reported once while the item runs, with the stack of the goroutine
+	report := output.String()
+	if n := strings.Count(report, "module stall stalled for"); n != 1 {
+		t.Fatalf("%v stall reports:\n%v", n, report)
+	}
+	if !strings.Contains(report, "in chanrpc slow: goroutine") || !strings.Contains(report, "time.Sleep") {
+		t.Fatalf("stall report without the item or the stack:\n%v", report)
+	}
+	if !strings.Contains(stats, "\r\nstall - ") || !strings.Contains(stats, "stalls: 1, last: ") ||
+		!strings.Contains(stats, " in chanrpc slow at ") {
+		t.Fatalf("stall not listed by the watchdog command:\n%v", stats)
+	}
+}
@@ -0,0 +1,83 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+)
+
+type QueueStat struct {
+	Len int
+	Cap int
+}
+
+func (q QueueStat) String() string {
+	return fmt.Sprintf("%v/%v", q.Len, q.Cap)
+}
+
+type ModuleStat struct {
+	Name  string
+	State State
+	// false for a module without Skeleton, the fields below are then zero
+	Skeleton bool
+	// the queues of the Skeleton: chanrpc calls, console commands, timers,
+	// Go callbacks and AsynCall callbacks
+	ChanCall        QueueStat
+	ChanCommand     QueueStat
+	ChanTimer       QueueStat
+	ChanCb          QueueStat
+	ChanAsynRet     QueueStat
+	PendingGo       int
+	PendingAsynCall int
+}
+
+// the stats of the registered modules
+// goroutine safe
+func ModuleStats() []ModuleStat {
+	mutexState.RLock()
+	defer mutexState.RUnlock()
+
+	stats := make([]ModuleStat, 0, len(mods))
+	for _, m := range mods {
+		stat := ModuleStat{Name: m.name, State: m.state}
+		if s, ok := m.mi.(interface {
+			skeleton() *Skeleton
+		}); ok && m.state != StateRegistered && m.state != StateInitializing {
+			s.skeleton().stat(&stat)
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+func (s *Skeleton) skeleton() *Skeleton {
+	return s
+}
+
+// the queues are replaced by Init, while the module is initializing
+func (s *Skeleton) stat(stat *ModuleStat) {
+	if s.g == nil {
+		return
+	}
+	stat.Skeleton = true
+	stat.ChanCall = QueueStat{s.server.Len(), s.server.Cap()}
+	stat.ChanCommand = QueueStat{s.commandServer.Len(), s.commandServer.Cap()}
+	stat.ChanTimer = QueueStat{len(s.dispatcher.ChanTimer), cap(s.dispatcher.ChanTimer)}
+	stat.ChanCb = QueueStat{len(s.g.ChanCb), cap(s.g.ChanCb)}
+	stat.ChanAsynRet = QueueStat{len(s.client.ChanAsynRet), cap(s.client.ChanAsynRet)}
+	stat.PendingGo = s.g.Pending()
+	stat.PendingAsynCall = s.client.PendingAsynCall()
+}
+
+func commandModuleStatus() string {
+	var lines []string
+	for _, s := range ModuleStats() {
+		line := s.Name + " - " + s.State.String()
+		if s.Skeleton {
+			line += fmt.Sprintf("\r\n  ChanCall: %v, ChanCommand: %v, ChanTimer: %v, ChanCb: %v, ChanAsynRet: %v"+
+				"\r\n  pending Go: %v, pending AsynCall: %v",
+				s.ChanCall, s.ChanCommand, s.ChanTimer, s.ChanCb, s.ChanAsynRet, s.PendingGo, s.PendingAsynCall)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\r\n")
+}
@@ -0,0 +1,68 @@
+package module
+
+// lifecycle states
+type State int
+
+const (
+	StateRegistered State = iota
+	StateInitializing
+	StateRunning
+	StateStopping
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRegistered:
+		return "registered"
+	case StateInitializing:
+		return "initializing"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+func (m *module) setState(s State) {
+	mutexState.Lock()
+	m.state = s
+	mutexState.Unlock()
+}
+
+func (m *module) getState() State {
+	mutexState.RLock()
+	defer mutexState.RUnlock()
+	return m.state
+}
+
+// goroutine safe
+func StateOf(name string) (State, bool) {
+	mutexState.RLock()
+	defer mutexState.RUnlock()
+
+	for _, m := range mods {
+		if m.name == name {
+			return m.state, true
+		}
+	}
+	return 0, false
+}
+
+// the names of the registered modules, in initialization order once Init
+// has been called
+// goroutine safe
+func Names() []string {
+	mutexState.RLock()
+	defer mutexState.RUnlock()
+
+	names := make([]string, len(mods))
+	for i, m := range mods {
+		names[i] = m.name
+	}
+	return names
+}
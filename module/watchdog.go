@@ -0,0 +1,257 @@
+package module
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/name5566/leaf/console"
+	"github.com/name5566/leaf/log"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watches the goroutine of a skeleton, a stall is reported when a work item
+// runs longer than the StallThreshold setting
+type watchdog struct {
+	name  string
+	goid  string
+	mutex sync.Mutex
+	// the work item running
+	busy     bool
+	since    time.Time
+	kind     string
+	id       interface{}
+	seq      uint64
+	reported uint64
+	// stalls
+	stalls    int
+	lastStall string
+}
+
+type WatchdogStat struct {
+	Name      string
+	Busy      time.Duration
+	Item      string
+	Stalls    int
+	LastStall string
+}
+
+var (
+	// the StallThreshold setting given to InitConfig, as a time.Duration
+	stallThreshold int64
+	watchdogs      = make(map[*watchdog]struct{})
+	mutexWatchdogs sync.Mutex
+	onceWatchdog   sync.Once
+)
+
+func init() {
+	console.RegisterFunc("watchdog", "stalled module goroutines", commandWatchdog)
+}
+
+// must be called on the watched goroutine
+func newWatchdog(name string) *watchdog {
+	if name == "" {
+		name = "skeleton"
+	}
+
+	w := new(watchdog)
+	w.name = name
+	w.goid = goroutineID()
+
+	mutexWatchdogs.Lock()
+	watchdogs[w] = struct{}{}
+	mutexWatchdogs.Unlock()
+
+	onceWatchdog.Do(func() {
+		go watch()
+	})
+	return w
+}
+
+func (w *watchdog) close() {
+	mutexWatchdogs.Lock()
+	delete(watchdogs, w)
+	mutexWatchdogs.Unlock()
+}
+
+func (w *watchdog) begin(kind string, id interface{}) {
+	w.mutex.Lock()
+	w.busy = true
+	w.since = time.Now()
+	w.kind = kind
+	w.id = id
+	w.seq++
+	w.mutex.Unlock()
+}
+
+func (w *watchdog) end() {
+	w.mutex.Lock()
+	w.busy = false
+	if w.reported == w.seq {
+		log.Release("module %v recovered after %v in %v",
+			w.name, time.Since(w.since), w.item())
+	}
+	w.id = nil
+	w.mutex.Unlock()
+}
+
+func (w *watchdog) item() string {
+	if w.id == nil || w.id == "" {
+		return w.kind
+	}
+	return fmt.Sprintf("%v %v", w.kind, w.id)
+}
+
+func (w *watchdog) check(now time.Time, threshold time.Duration) {
+	w.mutex.Lock()
+	if !w.busy || w.reported == w.seq || now.Sub(w.since) < threshold {
+		w.mutex.Unlock()
+		return
+	}
+	w.reported = w.seq
+	w.stalls++
+	d := now.Sub(w.since)
+	item := w.item()
+	w.lastStall = fmt.Sprintf("%v in %v at %v", d, item, w.since.Format("2006-01-02 15:04:05"))
+	w.mutex.Unlock()
+
+	log.Error("module %v stalled for %v in %v: %s", w.name, d, item, goroutineStack(w.goid))
+}
+
+func (w *watchdog) stat(now time.Time) WatchdogStat {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	s := WatchdogStat{
+		Name:      w.name,
+		Stalls:    w.stalls,
+		LastStall: w.lastStall,
+	}
+	if w.busy {
+		s.Busy = now.Sub(w.since)
+		s.Item = w.item()
+	}
+	return s
+}
+
+func setStallThreshold(d time.Duration) {
+	atomic.StoreInt64(&stallThreshold, int64(d))
+}
+
+// goroutine safe
+func getStallThreshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&stallThreshold))
+}
+
+func watch() {
+	for {
+		threshold := getStallThreshold()
+		if threshold <= 0 {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		interval := threshold / 4
+		if interval < 10*time.Millisecond {
+			interval = 10 * time.Millisecond
+		}
+		time.Sleep(interval)
+
+		now := time.Now()
+		mutexWatchdogs.Lock()
+		ws := make([]*watchdog, 0, len(watchdogs))
+		for w := range watchdogs {
+			ws = append(ws, w)
+		}
+		mutexWatchdogs.Unlock()
+
+		for _, w := range ws {
+			w.check(now, threshold)
+		}
+	}
+}
+
+// goroutine safe
+func WatchdogStats() []WatchdogStat {
+	now := time.Now()
+
+	mutexWatchdogs.Lock()
+	stats := make([]WatchdogStat, 0, len(watchdogs))
+	for w := range watchdogs {
+		stats = append(stats, w.stat(now))
+	}
+	mutexWatchdogs.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// goroutine 18 [running]:
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		return string(buf[:i])
+	}
+	return ""
+}
+
+func goroutineStack(goid string) []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	i := bytes.Index(buf, []byte("goroutine "+goid+" ["))
+	if i < 0 {
+		return nil
+	}
+	stack := buf[i:]
+	if j := bytes.Index(stack, []byte("\n\n")); j >= 0 {
+		stack = stack[:j]
+	}
+	return stack
+}
+
+func funcName(f interface{}) string {
+	if f == nil {
+		return ""
+	}
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+func commandWatchdog(args []string) string {
+	threshold := getStallThreshold()
+	if threshold <= 0 {
+		return "watchdog disabled (StallThreshold is not set)"
+	}
+
+	lines := []string{"threshold: " + threshold.String()}
+	for _, s := range WatchdogStats() {
+		line := s.Name + " - "
+		if s.Item != "" {
+			line += "busy for " + s.Busy.String() + " in " + s.Item
+		} else {
+			line += "idle"
+		}
+		line += ", stalls: " + strconv.Itoa(s.Stalls)
+		if s.LastStall != "" {
+			line += ", last: " + s.LastStall
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\r\n")
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/name5566/leaf/chanrpc"
 	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/tracing"
 	"reflect"
 )
 
@@ -95,6 +96,12 @@ func (p *Processor) SetRawHandler(msgID string, msgRawHandler MsgHandler) {
 
 // goroutine safe
 func (p *Processor) Route(msg interface{}, userData interface{}) error {
+	return p.RouteSpan(msg, userData, nil)
+}
+
+// Route with the span of the message, the chanrpc call is its child
+// goroutine safe
+func (p *Processor) RouteSpan(msg interface{}, userData interface{}, span *tracing.Span) error {
 	// raw
 	if msgRaw, ok := msg.(MsgRaw); ok {
 		i, ok := p.msgInfo[msgRaw.msgID]
@@ -121,7 +128,7 @@ func (p *Processor) Route(msg interface{}, userData interface{}) error {
 		i.msgHandler([]interface{}{msg, userData})
 	}
 	if i.msgRouter != nil {
-		i.msgRouter.Go(msgType, msg, userData)
+		i.msgRouter.GoSpan(span, msgType, msg, userData)
 	}
 	return nil
 }
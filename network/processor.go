@@ -1,5 +1,9 @@
 package network
 
+import (
+	"github.com/name5566/leaf/tracing"
+)
+
 type Processor interface {
 	// must goroutine safe
 	Route(msg interface{}, userData interface{}) error
@@ -8,3 +12,11 @@ type Processor interface {
 	// must goroutine safe
 	Marshal(msg interface{}) ([][]byte, error)
 }
+
+// a Processor passing the span of a message on to the chanrpc server the
+// message is routed to
+type SpanProcessor interface {
+	Processor
+	// must goroutine safe
+	RouteSpan(msg interface{}, userData interface{}, span *tracing.Span) error
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/name5566/leaf/chanrpc"
 	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/tracing"
 	"math"
 	"reflect"
 )
@@ -100,6 +101,12 @@ func (p *Processor) SetRawHandler(id uint16, msgRawHandler MsgHandler) {
 
 // goroutine safe
 func (p *Processor) Route(msg interface{}, userData interface{}) error {
+	return p.RouteSpan(msg, userData, nil)
+}
+
+// Route with the span of the message, the chanrpc call is its child
+// goroutine safe
+func (p *Processor) RouteSpan(msg interface{}, userData interface{}, span *tracing.Span) error {
 	// raw
 	if msgRaw, ok := msg.(MsgRaw); ok {
 		if msgRaw.msgID >= uint16(len(p.msgInfo)) {
@@ -123,7 +130,7 @@ func (p *Processor) Route(msg interface{}, userData interface{}) error {
 		i.msgHandler([]interface{}{msg, userData})
 	}
 	if i.msgRouter != nil {
-		i.msgRouter.Go(msgType, msg, userData)
+		i.msgRouter.GoSpan(span, msgType, msg, userData)
 	}
 	return nil
 }
@@ -128,3 +128,11 @@ func (client *TCPClient) Close() {
 
 	client.wg.Wait()
 }
+
+// the number of established connections
+// goroutine safe
+func (client *TCPClient) NumConn() int {
+	client.Lock()
+	defer client.Unlock()
+	return len(client.conns)
+}
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"crypto/tls"
 	"github.com/name5566/leaf/log"
 	"net"
 	"sync"
@@ -12,6 +13,7 @@ type TCPServer struct {
 	MaxConnNum      int
 	PendingWriteNum int
 	NewAgent        func(*TCPConn) Agent
+	TLSConfig       *tls.Config // accept TLS connections if not nil
 	ln              net.Listener
 	conns           ConnSet
 	mutexConns      sync.Mutex
@@ -36,6 +38,9 @@ func (server *TCPServer) init() {
 	if err != nil {
 		log.Fatal("%v", err)
 	}
+	if server.TLSConfig != nil {
+		ln = tls.NewListener(ln, server.TLSConfig)
+	}
 
 	if server.MaxConnNum <= 0 {
 		server.MaxConnNum = 100
@@ -125,3 +130,11 @@ func (server *TCPServer) Close() {
 	server.mutexConns.Unlock()
 	server.wgConns.Wait()
 }
+
+// the number of connections
+// goroutine safe
+func (server *TCPServer) NumConn() int {
+	server.mutexConns.Lock()
+	defer server.mutexConns.Unlock()
+	return len(server.conns)
+}
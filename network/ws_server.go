@@ -152,3 +152,14 @@ func (server *WSServer) Close() {
 
 	server.handler.wg.Wait()
 }
+
+// the number of connections
+// goroutine safe
+func (server *WSServer) NumConn() int {
+	if server.handler == nil {
+		return 0
+	}
+	server.handler.mutexConns.Lock()
+	defer server.handler.mutexConns.Unlock()
+	return len(server.handler.conns)
+}
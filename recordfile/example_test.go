@@ -3,6 +3,7 @@ package recordfile_test
 import (
 	"fmt"
 	"github.com/name5566/leaf/recordfile"
+	"time"
 )
 
 func Example() {
@@ -65,3 +66,223 @@ func Example() {
 	// name5566
 	// 6
 }
+
+func ExampleRegister() {
+	type Record struct {
+		IndexInt int    `rf:"index,unique"`
+		IndexStr string `rf:"index,unique"`
+		_Number  int32
+		Str      string
+		Arr1     [2]int
+		Arr2     [3][2]int
+		Arr3     []int
+		St       struct {
+			Name string `json:"name"`
+			Num  int    `json:"num"`
+		}
+		M map[string]int
+	}
+
+	t, err := recordfile.Register("example", Record{}, "test.txt", func(rf *recordfile.RecordFile) error {
+		if rf.NumRecord() == 0 {
+			return fmt.Errorf("empty table")
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(t.Version(), t.RecordFile().NumRecord())
+
+	err = t.Reload()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(t.Version(), t.RecordFile().Index(3).(*Record).Str)
+
+	// Output:
+	// 1 3
+	// 2 book
+}
+
+func ExampleRecordFile_Find() {
+	type Item struct {
+		ID    int `rf:"index,unique"`
+		Type  int `rf:"index"`
+		Level int `rf:"unique=LevelClass"`
+		Class int `rf:"unique=LevelClass"`
+		Name  string
+	}
+
+	rf, err := recordfile.New(Item{})
+	if err != nil {
+		return
+	}
+
+	err = rf.Read("items.txt")
+	if err != nil {
+		return
+	}
+
+	fmt.Println(rf.Get("ID", 3).(*Item).Name)
+
+	for _, r := range rf.Find("Type", 1) {
+		fmt.Println(r.(*Item).Name)
+	}
+
+	fmt.Println(rf.Get("LevelClass", 1, 2).(*Item).Name)
+	fmt.Println(rf.Get("LevelClass", 2, 2))
+
+	// Output:
+	// shield
+	// sword
+	// bow
+	// bow
+	// <nil>
+}
+
+func ExampleValidate() {
+	type Item struct {
+		ID    int `rf:"index,unique"`
+		Type  int
+		Level int
+		Class int
+		Name  string
+	}
+	type Goods struct {
+		ID       int    `rf:"index,unique"`
+		Items    []int  `ref:"items.ID"`
+		Price    int    `range:"1,"`
+		Currency string `enum:"gold|diamond"`
+	}
+
+	_, err := recordfile.Register("items", Item{}, "items.txt", nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	_, err = recordfile.Register("shop", Goods{}, "shop.txt", nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(recordfile.Validate())
+
+	// Output:
+	// validate tables error:
+	//   shop.txt (line=3, col=1) Items: 9 not found in items.ID
+	//   shop.txt (line=3, col=2) Price: 0 out of range [1, ]
+	//   shop.txt (line=4, col=3) Currency: gems not in gold|diamond
+}
+
+func ExampleRecordFile_Read() {
+	type Item struct {
+		ID    int `rf:"index,unique"`
+		Type  int
+		Level int
+		Class int
+		Name  string
+	}
+
+	for _, name := range []string{"items.txt", "items.xlsx", "items.json"} {
+		rf, err := recordfile.New(Item{})
+		if err != nil {
+			return
+		}
+
+		err = rf.Read(name)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Println(name, rf.NumRecord(), rf.Get("ID", 3).(*Item).Name)
+	}
+
+	// Output:
+	// items.txt 4 shield
+	// items.xlsx 4 shield
+	// items.json 4 shield
+}
+
+func ExampleRecordFile_IgnoreExtra() {
+	type Event struct {
+		ID    int    `rf:"index,unique"`
+		Title string `col:"Name"`
+		Start time.Time
+		End   *time.Time
+		Limit int `default:"10"`
+	}
+
+	rf, err := recordfile.New(Event{})
+	if err != nil {
+		return
+	}
+
+	rf.Mapping = recordfile.MapByName
+	err = rf.Read("events.txt")
+	fmt.Println(err)
+
+	rf.IgnoreExtra = true
+	err = rf.Read("events.txt")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for i := 0; i < rf.NumRecord(); i++ {
+		e := rf.Record(i).(*Event)
+		fmt.Println(e.ID, e.Title, e.Start.Format("2006-01-02 15:04"), e.End != nil, e.Limit)
+	}
+
+	// Output:
+	// column Note (col=4) not mapped to a field
+	// 1 spring 2024-03-01 00:00 true 10
+	// 2 opening 2024-05-01 10:00 false 10
+}
+
+func ExampleRecordFile_Read_events() {
+	type Event struct {
+		ID    int    `rf:"index,unique"`
+		Title string `col:"Name"`
+		Start time.Time
+		End   *time.Time
+		Limit int `default:"10"`
+	}
+
+	for _, name := range []string{"events.txt", "events.xlsx", "events.json"} {
+		rf, err := recordfile.New(Event{})
+		if err != nil {
+			return
+		}
+		rf.IgnoreExtra = true
+		rf.Mapping = recordfile.MapByName
+
+		err = rf.Read(name)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		for i := 0; i < rf.NumRecord(); i++ {
+			e := rf.Record(i).(*Event)
+			end := "-"
+			if e.End != nil {
+				end = e.End.Format("2006-01-02 15:04:05")
+			}
+			fmt.Println(name, e.ID, e.Title, e.Start.Format("2006-01-02 15:04"), end, e.Limit)
+		}
+	}
+
+	// Output:
+	// events.txt 1 spring 2024-03-01 00:00 2024-03-31 23:59:59 10
+	// events.txt 2 opening 2024-05-01 10:00 - 10
+	// events.xlsx 1 spring 2024-03-01 00:00 2024-03-31 23:59:59 10
+	// events.xlsx 2 opening 2024-05-01 10:00 - 10
+	// events.json 1 spring 2024-03-01 00:00 2024-03-31 23:59:59 20
+	// events.json 2 opening 2024-05-01 10:00 - 10
+}
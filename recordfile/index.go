@@ -0,0 +1,180 @@
+package recordfile
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// an index declared with the tag rf:
+//
+// rf:"index"        - a non-unique index of the field, named after the field
+// rf:"index,unique" - a unique index of the field (or rf:"unique")
+// rf:"index=name"   - the field is part of the non-unique composite index name
+// rf:"unique=name"  - the field is part of the unique composite index name
+//
+// the fields of a composite index are in the order of the struct fields.
+// a unique index of a single field is also reached by Indexes, in the order of
+// the fields (as the index of a field tagged exactly "index")
+type index struct {
+	name   string
+	fields []int
+	unique bool
+	m      map[interface{}][]interface{}
+}
+
+var typeInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+
+func parseIndexes(typeRecord reflect.Type) ([]*index, []bool, error) {
+	var indexes []*index
+	byName := make(map[string]*index)
+	positional := make([]bool, typeRecord.NumField())
+
+	add := func(name string, i int, unique bool) {
+		idx := byName[name]
+		if idx == nil {
+			idx = &index{name: name}
+			byName[name] = idx
+			indexes = append(indexes, idx)
+		}
+		idx.fields = append(idx.fields, i)
+		idx.unique = idx.unique || unique
+	}
+
+	for i := 0; i < typeRecord.NumField(); i++ {
+		f := typeRecord.Field(i)
+
+		var opts []string
+		if f.Tag == "index" {
+			opts = []string{"index", "unique"}
+		} else if tag := f.Tag.Get("rf"); tag != "" {
+			opts = strings.Split(tag, ",")
+		}
+		if len(opts) == 0 {
+			continue
+		}
+
+		single := false
+		unique := false
+		for _, opt := range opts {
+			opt = strings.TrimSpace(opt)
+			switch {
+			case opt == "index":
+				single = true
+			case opt == "unique":
+				single = true
+				unique = true
+			case strings.HasPrefix(opt, "index="):
+				add(opt[len("index="):], i, false)
+			case strings.HasPrefix(opt, "unique="):
+				add(opt[len("unique="):], i, true)
+			default:
+				return nil, nil, fmt.Errorf("field %v %v: unknown rf option %q", i, f.Name, opt)
+			}
+		}
+		if single {
+			if _, ok := byName[f.Name]; ok {
+				return nil, nil, fmt.Errorf("field %v %v: index %v already declared", i, f.Name, f.Name)
+			}
+			add(f.Name, i, unique)
+		}
+		positional[i] = single && unique
+
+		switch f.Type.Kind() {
+		case reflect.Struct, reflect.Slice, reflect.Map, reflect.Ptr:
+			return nil, nil, fmt.Errorf("could not index %s field %v %v",
+				f.Type.Kind(), i, f.Name)
+		}
+		if f.PkgPath != "" {
+			return nil, nil, fmt.Errorf("could not index unexported field %v %v", i, f.Name)
+		}
+	}
+
+	return indexes, positional, nil
+}
+
+// key of a record, an array of interface{} for composite indexes
+func (idx *index) key(record reflect.Value) interface{} {
+	if len(idx.fields) == 1 {
+		return record.Field(idx.fields[0]).Interface()
+	}
+
+	key := reflect.New(reflect.ArrayOf(len(idx.fields), typeInterface)).Elem()
+	for i, f := range idx.fields {
+		key.Index(i).Set(record.Field(f))
+	}
+	return key.Interface()
+}
+
+// rows are the line numbers of the records
+func (rf *RecordFile) buildIndexes(records []interface{}, rows []int) (map[string]*index, error) {
+	named := make(map[string]*index, len(rf.indexSpecs))
+	for _, spec := range rf.indexSpecs {
+		idx := &index{
+			name:   spec.name,
+			fields: spec.fields,
+			unique: spec.unique,
+			m:      make(map[interface{}][]interface{}),
+		}
+		for n, r := range records {
+			key := idx.key(reflect.ValueOf(r).Elem())
+			if idx.unique && len(idx.m[key]) > 0 {
+				return nil, fmt.Errorf("index %v error: duplicate %v at (line=%v)",
+					idx.name, key, rows[n])
+			}
+			idx.m[key] = append(idx.m[key], r)
+		}
+		named[idx.name] = idx
+	}
+	return named, nil
+}
+
+func (rf *RecordFile) lookup(name string, values []interface{}) []interface{} {
+	idx := rf.named[name]
+	if idx == nil {
+		panic(fmt.Sprintf("index %v not declared", name))
+	}
+	if len(values) != len(idx.fields) {
+		panic(fmt.Sprintf("index %v: %v values for %v fields", name, len(values), len(idx.fields)))
+	}
+
+	key := reflect.New(rf.typeRecord).Elem()
+	for i, f := range idx.fields {
+		v, ok := convert(reflect.ValueOf(values[i]), rf.typeRecord.Field(f).Type)
+		if !ok {
+			return nil
+		}
+		key.Field(f).Set(v)
+	}
+	return idx.m[idx.key(key)]
+}
+
+// converts between numeric types, e.g. an int value for an int32 field
+func convert(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return v, false
+	}
+	if v.Type() == t {
+		return v, true
+	}
+	if (v.Kind() == reflect.String) != (t.Kind() == reflect.String) ||
+		!v.Type().ConvertibleTo(t) {
+		return v, false
+	}
+	return v.Convert(t), true
+}
+
+// Get returns the record matched by the values of the fields of an index, or
+// the first one for a non-unique index, nil if none
+func (rf *RecordFile) Get(name string, values ...interface{}) interface{} {
+	records := rf.lookup(name, values)
+	if len(records) == 0 {
+		return nil
+	}
+	return records[0]
+}
+
+// Find returns the records matched by the values of the fields of an index
+func (rf *RecordFile) Find(name string, values ...interface{}) []interface{} {
+	return rf.lookup(name, values)
+}
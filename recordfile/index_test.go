@@ -0,0 +1,47 @@
+package recordfile_test
+
+import (
+	"github.com/name5566/leaf/recordfile"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexesSkippedField(t *testing.T) {
+	// the first index is of a field not read from the file
+	type Hero struct {
+		Slot int `col:"-" rf:"index,unique"`
+		ID   int `rf:"index,unique"`
+		Name string
+	}
+
+	dir, err := ioutil.TempDir("", "recordfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "heroes.txt")
+	err = ioutil.WriteFile(file, []byte("ID\tName\n7\tarcher\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err := recordfile.New(Hero{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.Mapping = recordfile.MapByName
+	err = rf.Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rf.Indexes(0)) != 0 {
+		t.Errorf("index of Slot %v, expected empty", rf.Indexes(0))
+	}
+	r, ok := rf.Indexes(1)[7].(*Hero)
+	if !ok || r.Name != "archer" {
+		t.Errorf("index of ID %v, expected archer at 7", rf.Indexes(1))
+	}
+}
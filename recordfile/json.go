@@ -0,0 +1,114 @@
+package recordfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"unicode"
+)
+
+// readJSON reads an array of objects as text, the header holds the keys in
+// the order they first appear. Strings are unquoted, null is empty and other
+// values are kept as JSON. nums are the line numbers of the objects (of the
+// array for the header). keys tells the columns set by every line, the other
+// columns are missing keys
+func readJSON(name string) (lines [][]string, nums []int, keys [][]bool, err error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// the line of the next token
+	lineNum := func(offset int64) int {
+		next := data[offset:]
+		if i := bytes.IndexFunc(next, func(r rune) bool {
+			return !unicode.IsSpace(r) && r != ','
+		}); i >= 0 {
+			next = next[i:]
+		}
+		return bytes.Count(data[:len(data)-len(next)], []byte("\n")) + 1
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	nums = append(nums, lineNum(0))
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var header []string
+	columns := make(map[string]int)
+	for dec.More() {
+		num := lineNum(dec.InputOffset())
+		if err := expectDelim(dec, '{'); err != nil {
+			return nil, nil, nil, fmt.Errorf("record %v: %v", len(lines)+1, err)
+		}
+
+		var line []string
+		var set []bool
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			key := t.(string)
+			c, ok := columns[key]
+			if !ok {
+				c = len(header)
+				columns[key] = c
+				header = append(header, key)
+			}
+
+			var raw json.RawMessage
+			err = dec.Decode(&raw)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			for len(line) <= c {
+				line = append(line, "")
+				set = append(set, false)
+			}
+			if line[c], err = jsonText(raw); err != nil {
+				return nil, nil, nil, err
+			}
+			set[c] = true
+		}
+
+		// '}'
+		if _, err := dec.Token(); err != nil {
+			return nil, nil, nil, err
+		}
+		lines = append(lines, line)
+		nums = append(nums, num)
+		keys = append(keys, set)
+	}
+
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, nil, nil, err
+	}
+	return append([][]string{header}, lines...), nums, append([][]bool{nil}, keys...), nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != delim {
+		return errors.New("expected " + delim.String())
+	}
+	return nil
+}
+
+func jsonText(raw json.RawMessage) (string, error) {
+	switch {
+	case string(raw) == "null":
+		return "", nil
+	case len(raw) > 0 && raw[0] == '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	default:
+		return string(raw), nil
+	}
+}
@@ -5,22 +5,52 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var Comma = '\t'
 var Comment = '#'
 
+// how the columns of a text file are mapped to the fields
+type Mapping int
+
+const (
+	// by name if every cell of the first row is empty or names a field, by
+	// position otherwise
+	MapAuto Mapping = iota + 1
+	MapByName
+	// the first row is skipped (e.g. a row of descriptions)
+	MapByPosition
+)
+
+var ColumnMapping = MapAuto
+
 type Index map[interface{}]interface{}
 
 type RecordFile struct {
-	Comma      rune
-	Comment    rune
-	typeRecord reflect.Type
-	records    []interface{}
-	indexes    []Index
+	Comma       rune
+	Comment     rune
+	Sheet       string
+	IgnoreExtra bool
+	Mapping     Mapping
+	typeRecord  reflect.Type
+	names       []string
+	defaults    []*string
+	indexSpecs  []*index
+	positional  []bool
+	checks      []check
+	file        string
+	columns     []int
+	rows        []int
+	records     []interface{}
+	indexes     []Index
+	named       map[string]*index
 }
 
 func New(st interface{}) (*RecordFile, error) {
@@ -29,10 +59,16 @@ func New(st interface{}) (*RecordFile, error) {
 		return nil, errors.New("st must be a struct")
 	}
 
+	names := make([]string, typeRecord.NumField())
+	defaults := make([]*string, typeRecord.NumField())
 	for i := 0; i < typeRecord.NumField(); i++ {
 		f := typeRecord.Field(i)
 
-		kind := f.Type.Kind()
+		t := f.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		kind := t.Kind()
 		switch kind {
 		case reflect.Bool:
 		case reflect.Int:
@@ -54,42 +90,322 @@ func New(st interface{}) (*RecordFile, error) {
 		case reflect.Map:
 		default:
 			return nil, fmt.Errorf("invalid type: %v %s",
-				f.Name, kind)
+				f.Name, f.Type)
+		}
+
+		names[i] = f.Name
+		if col := f.Tag.Get("col"); col != "" {
+			names[i] = col
 		}
 
-		tag := f.Tag
-		if tag == "index" {
-			switch kind {
-			case reflect.Struct, reflect.Slice, reflect.Map:
-				return nil, fmt.Errorf("could not index %s field %v %v",
-					kind, i, f.Name)
+		if d, ok := f.Tag.Lookup("default"); ok {
+			if f.PkgPath != "" {
+				return nil, fmt.Errorf("field %v %v: default of unexported field", i, f.Name)
 			}
+			err := parseField(reflect.New(f.Type).Elem(), d)
+			if err != nil {
+				return nil, fmt.Errorf("field %v %v: invalid default %q: %v", i, f.Name, d, err)
+			}
+			defaults[i] = &d
 		}
 	}
 
+	indexSpecs, positional, err := parseIndexes(typeRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	checks, err := parseChecks(typeRecord)
+	if err != nil {
+		return nil, err
+	}
+
 	rf := new(RecordFile)
 	rf.typeRecord = typeRecord
+	rf.names = names
+	rf.defaults = defaults
+	rf.indexSpecs = indexSpecs
+	rf.positional = positional
+	rf.checks = checks
 
 	return rf, nil
 }
 
+// Read reads a file by its extension:
+//
+// .xlsx - a sheet of an Excel workbook (RecordFile.Sheet, default: the first)
+// .json - an array of objects
+// other - text delimited by RecordFile.Comma
+//
+// the first row of an Excel sheet or of a text file holds the column names and
+// the keys of the JSON objects name the columns. Columns are mapped to the
+// fields by name (case insensitive), the name of a field is its name or the
+// tag col, col:"-" for a field not read from the file. A field tagged default
+// is set to the default value when its column is missing or its cell is
+// empty, the other columns must be found. Columns not mapped to a field are an
+// error unless RecordFile.IgnoreExtra is set. A key missing in a JSON object
+// is a missing column for the record: the field is set to its default value,
+// left nil for a pointer, and is an error otherwise
+//
+// the columns of a text file are mapped as set by RecordFile.Mapping
+// (ColumnMapping if not set), MapAuto maps them by name if every non-empty
+// cell of the first row names a field and by position otherwise
 func (rf *RecordFile) Read(name string) error {
-	file, err := os.Open(name)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
 	if rf.Comma == 0 {
 		rf.Comma = Comma
 	}
 	if rf.Comment == 0 {
 		rf.Comment = Comment
 	}
+	if rf.Mapping == 0 {
+		rf.Mapping = ColumnMapping
+	}
+
+	var lines [][]string
+	var nums []int
+	var keys [][]bool
+	var err error
+	byName := true
+	switch strings.ToLower(path.Ext(name)) {
+	case ".xlsx":
+		lines, nums, err = readXLSX(name, rf.Sheet, rf.Comment)
+	case ".json":
+		lines, nums, keys, err = readJSON(name)
+	default:
+		lines, nums, err = rf.readText(name)
+		switch rf.Mapping {
+		case MapByName:
+		case MapByPosition:
+			byName = false
+		default:
+			byName = len(lines) > 0 && rf.namesColumns(lines[0])
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return rf.parse(name, lines, nums, keys, byName)
+}
+
+// readText reads the lines of a text file and the line number in the file of
+// every line, the comment lines are skipped
+func (rf *RecordFile) readText(name string) (lines [][]string, nums []int, err error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
 	reader := csv.NewReader(file)
 	reader.Comma = rf.Comma
-	reader.Comment = rf.Comment
-	lines, err := reader.ReadAll()
+	if rf.Comment > 0 {
+		reader.Comment = rf.Comment
+	}
+	reader.FieldsPerRecord = -1
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		num, _ := reader.FieldPos(0)
+		lines = append(lines, line)
+		nums = append(nums, num)
+	}
+	if len(lines) > 0 && len(lines[0]) > 0 {
+		lines[0][0] = strings.TrimPrefix(lines[0][0], "\ufeff")
+	}
+	return lines, nums, nil
+}
+
+// ReadRows reads the rows of a text file delimited by comma or of a sheet of
+// an Excel workbook (the first one if sheet is empty) as text, comment rows
+// included
+func ReadRows(name string, sheet string, comma rune) ([][]string, error) {
+	var rows [][]string
+	var err error
+	if strings.ToLower(path.Ext(name)) == ".xlsx" {
+		rows, _, err = readXLSX(name, sheet, 0)
+	} else {
+		rf := &RecordFile{Comma: comma, Comment: -1}
+		rows, _, err = rf.readText(name)
+	}
+	return rows, err
+}
+
+// whether every cell of the header is empty or names a field
+func (rf *RecordFile) namesColumns(header []string) bool {
+	named := false
+	for _, h := range header {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		found := false
+		for i, name := range rf.names {
+			if rf.typeRecord.Field(i).PkgPath == "" && name != "-" && strings.EqualFold(h, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		named = true
+	}
+	return named
+}
+
+// the column of every field, -1 for fields not read from the file
+func (rf *RecordFile) mapColumns(header []string, byName bool) ([]int, error) {
+	typeRecord := rf.typeRecord
+	columns := make([]int, typeRecord.NumField())
+	if !byName {
+		for i := range columns {
+			columns[i] = i
+		}
+		return columns, nil
+	}
+
+	names := make(map[string]int)
+	for c, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" {
+			continue
+		}
+		if _, ok := names[h]; ok {
+			return nil, fmt.Errorf("duplicate column %v (col=%v)", header[c], c)
+		}
+		names[h] = c
+	}
+
+	used := make(map[int]bool)
+	for i := range columns {
+		f := typeRecord.Field(i)
+		if f.PkgPath != "" || rf.names[i] == "-" {
+			columns[i] = -1
+			continue
+		}
+		c, ok := names[strings.ToLower(rf.names[i])]
+		if !ok {
+			if rf.defaults[i] == nil {
+				return nil, fmt.Errorf("column %v not found", rf.names[i])
+			}
+			columns[i] = -1
+			continue
+		}
+		columns[i] = c
+		used[c] = true
+	}
+	if !rf.IgnoreExtra {
+		for c, h := range header {
+			if strings.TrimSpace(h) != "" && !used[c] {
+				return nil, fmt.Errorf("column %v (col=%v) not mapped to a field", h, c)
+			}
+		}
+	}
+
+	return columns, nil
+}
+
+var typeTime = reflect.TypeOf(time.Time{})
+
+// the layouts of time.Time fields, in the local time zone if the zone is not
+// given
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// parseField sets field to the value of strField, an empty strField leaves
+// pointer fields nil
+func parseField(field reflect.Value, strField string) error {
+	var err error
+
+	kind := field.Kind()
+	if kind == reflect.Ptr {
+		if strField == "" {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		v := reflect.New(field.Type().Elem())
+		err = parseField(v.Elem(), strField)
+		if err == nil {
+			field.Set(v)
+		}
+	} else if field.Type() == typeTime {
+		var v time.Time
+		v, err = parseTime(strField)
+		if err == nil {
+			field.Set(reflect.ValueOf(v))
+		}
+	} else if kind == reflect.Bool {
+		var v bool
+		v, err = strconv.ParseBool(strField)
+		if err == nil {
+			field.SetBool(v)
+		}
+	} else if kind == reflect.Int ||
+		kind == reflect.Int8 ||
+		kind == reflect.Int16 ||
+		kind == reflect.Int32 ||
+		kind == reflect.Int64 {
+		var v int64
+		v, err = strconv.ParseInt(strField, 0, field.Type().Bits())
+		if err == nil {
+			field.SetInt(v)
+		}
+	} else if kind == reflect.Uint ||
+		kind == reflect.Uint8 ||
+		kind == reflect.Uint16 ||
+		kind == reflect.Uint32 ||
+		kind == reflect.Uint64 {
+		var v uint64
+		v, err = strconv.ParseUint(strField, 0, field.Type().Bits())
+		if err == nil {
+			field.SetUint(v)
+		}
+	} else if kind == reflect.Float32 ||
+		kind == reflect.Float64 {
+		var v float64
+		v, err = strconv.ParseFloat(strField, field.Type().Bits())
+		if err == nil {
+			field.SetFloat(v)
+		}
+	} else if kind == reflect.String {
+		field.SetString(strField)
+	} else if kind == reflect.Struct ||
+		kind == reflect.Array ||
+		kind == reflect.Slice ||
+		kind == reflect.Map {
+		err = json.Unmarshal([]byte(strField), field.Addr().Interface())
+	}
+
+	return err
+}
+
+// nums are the line numbers of the lines in the file (the rows of a sheet).
+// keys tells the cells set by every line of a JSON file, nil for the other
+// files
+func (rf *RecordFile) parse(name string, lines [][]string, nums []int, keys [][]bool, byName bool) error {
+	if len(lines) == 0 {
+		return errors.New("header not found")
+	}
+	columns, err := rf.mapColumns(lines[0], byName)
 	if err != nil {
 		return err
 	}
@@ -98,12 +414,12 @@ func (rf *RecordFile) Read(name string) error {
 
 	// make records
 	records := make([]interface{}, len(lines)-1)
+	rows := make([]int, len(lines)-1)
 
 	// make indexes
 	indexes := []Index{}
 	for i := 0; i < typeRecord.NumField(); i++ {
-		tag := typeRecord.Field(i).Tag
-		if tag == "index" {
+		if rf.positional[i] {
 			indexes = append(indexes, make(Index))
 		}
 	}
@@ -111,95 +427,95 @@ func (rf *RecordFile) Read(name string) error {
 	for n := 1; n < len(lines); n++ {
 		value := reflect.New(typeRecord)
 		records[n-1] = value.Interface()
+		rows[n-1] = nums[n]
 		record := value.Elem()
 
 		line := lines[n]
-		if len(line) != typeRecord.NumField() {
+		if !byName && (len(line) < typeRecord.NumField() ||
+			len(line) > typeRecord.NumField() && !rf.IgnoreExtra) {
 			return fmt.Errorf("line %v, field count mismatch: %v (file) %v (st)",
-				n, len(line), typeRecord.NumField())
+				nums[n], len(line), typeRecord.NumField())
 		}
 
 		iIndex := 0
 
 		for i := 0; i < typeRecord.NumField(); i++ {
-			f := typeRecord.Field(i)
+			// the index of the field, taken before a field not read is
+			// skipped so that the next indexes keep their positions
+			var index Index
+			if rf.positional[i] {
+				index = indexes[iIndex]
+				iIndex++
+			}
 
 			// records
-			strField := line[i]
 			field := record.Field(i)
 			if !field.CanSet() {
 				continue
 			}
-
-			var err error
-
-			kind := f.Type.Kind()
-			if kind == reflect.Bool {
-				var v bool
-				v, err = strconv.ParseBool(strField)
-				if err == nil {
-					field.SetBool(v)
+			col := columns[i]
+			missing := col < 0 || keys != nil && (col >= len(keys[n]) || !keys[n][col])
+			strField := ""
+			if missing {
+				if rf.defaults[i] != nil {
+					strField = *rf.defaults[i]
+				} else if col >= 0 && field.Kind() != reflect.Ptr {
+					return fmt.Errorf("field %v missing (line=%v)", rf.names[i], nums[n])
+				} else {
+					continue
 				}
-			} else if kind == reflect.Int ||
-				kind == reflect.Int8 ||
-				kind == reflect.Int16 ||
-				kind == reflect.Int32 ||
-				kind == reflect.Int64 {
-				var v int64
-				v, err = strconv.ParseInt(strField, 0, f.Type.Bits())
-				if err == nil {
-					field.SetInt(v)
-				}
-			} else if kind == reflect.Uint ||
-				kind == reflect.Uint8 ||
-				kind == reflect.Uint16 ||
-				kind == reflect.Uint32 ||
-				kind == reflect.Uint64 {
-				var v uint64
-				v, err = strconv.ParseUint(strField, 0, f.Type.Bits())
-				if err == nil {
-					field.SetUint(v)
-				}
-			} else if kind == reflect.Float32 ||
-				kind == reflect.Float64 {
-				var v float64
-				v, err = strconv.ParseFloat(strField, f.Type.Bits())
-				if err == nil {
-					field.SetFloat(v)
-				}
-			} else if kind == reflect.String {
-				field.SetString(strField)
-			} else if kind == reflect.Struct ||
-				kind == reflect.Array ||
-				kind == reflect.Slice ||
-				kind == reflect.Map {
-				err = json.Unmarshal([]byte(strField), field.Addr().Interface())
+			} else if col < len(line) {
+				strField = line[col]
+			}
+			if strField == "" && rf.defaults[i] != nil {
+				strField = *rf.defaults[i]
 			}
 
+			err := parseField(field, strField)
 			if err != nil {
-				return fmt.Errorf("parse field (row=%v, col=%v) error: %v",
-					n, i, err)
+				return fmt.Errorf("parse field (%v) error: %v",
+					rf.cell(nums[n], col, i), err)
 			}
 
 			// indexes
-			if f.Tag == "index" {
-				index := indexes[iIndex]
-				iIndex++
+			if index != nil {
 				if _, ok := index[field.Interface()]; ok {
-					return fmt.Errorf("index error: duplicate at (row=%v, col=%v)",
-						n, i)
+					return fmt.Errorf("index error: duplicate at (%v)",
+						rf.cell(nums[n], col, i))
 				}
 				index[field.Interface()] = records[n-1]
 			}
 		}
 	}
 
+	named, err := rf.buildIndexes(records, rows)
+	if err != nil {
+		return err
+	}
+
+	rf.file = name
+	rf.columns = columns
+	rf.rows = rows
 	rf.records = records
 	rf.indexes = indexes
+	rf.named = named
 
 	return nil
 }
 
+// the position of the cell of the field i in the errors, the column is named
+// if it is not in the file
+func (rf *RecordFile) cell(line int, col int, i int) string {
+	if col < 0 {
+		name := rf.names[i]
+		if name == "-" {
+			name = rf.typeRecord.Field(i).Name
+		}
+		return fmt.Sprintf("line=%v, column %v not in the file", line, name)
+	}
+	return fmt.Sprintf("line=%v, col=%v", line, col)
+}
+
 func (rf *RecordFile) Record(i int) interface{} {
 	return rf.records[i]
 }
@@ -0,0 +1,316 @@
+// rfgen generates the Go record struct of a recordfile table, with typed
+// index accessors and optionally the registration of the table.
+//
+// The first row of the table names the columns and the second row, a comment
+// row, gives the type of every column followed by its options:
+//
+//	ID		Type		Level			Class			Name
+//	#int unique	int index	int unique=LevelClass	int unique=LevelClass	string
+//
+// types are Go types (time for time.Time), options are:
+//
+//	index, unique, index=name, unique=name - indexes (tag rf)
+//	ref=table.index, range=min,max, enum=a|b, default=value
+//
+// Usage:
+//
+//	go run github.com/name5566/leaf/recordfile/rfgen -pkg gamedata -type Item -o item.go items.txt
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/name5566/leaf/recordfile"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	pkg      = flag.String("pkg", "gamedata", "package name")
+	typeName = flag.String("type", "", "struct name (default: the file name)")
+	output   = flag.String("o", "", "output file (default: stdout)")
+	sheet    = flag.String("sheet", "", "sheet of an Excel workbook (default: the first)")
+	comma    = flag.String("comma", "\t", "delimiter of a text file")
+	register = flag.String("register", "", "register the table read from the given path")
+	table    = flag.String("table", "", "name of the registered table (default: the file name)")
+)
+
+type column struct {
+	name  string
+	field string
+	typ   string
+	tags  []string
+}
+
+type index struct {
+	name   string
+	unique bool
+	fields []*column
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: rfgen [flags] file\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rfgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(file string) error {
+	c := []rune(*comma)
+	if len(c) != 1 {
+		return fmt.Errorf("invalid delimiter %q", *comma)
+	}
+	rows, err := recordfile.ReadRows(file, *sheet, c[0])
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if *typeName == "" {
+		*typeName = exported(base)
+	}
+	if *table == "" {
+		*table = base
+	}
+
+	columns, indexes, err := parseHeader(rows)
+	if err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+
+	src, err := generate(filepath.Base(file), columns, indexes)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*output, src, 0644)
+}
+
+func parseHeader(rows [][]string) ([]*column, []*index, error) {
+	if len(rows) < 2 || !strings.HasPrefix(rows[1][0], string(recordfile.Comment)) {
+		return nil, nil, fmt.Errorf("the second row must be a comment row of types")
+	}
+	names := rows[0]
+	types := append([]string(nil), rows[1]...)
+	types[0] = strings.TrimPrefix(types[0], string(recordfile.Comment))
+
+	var columns []*column
+	var indexes []*index
+	byName := make(map[string]*index)
+	fields := make(map[string]bool)
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if i >= len(types) || strings.TrimSpace(types[i]) == "" {
+			return nil, nil, fmt.Errorf("column %v: type not found", name)
+		}
+
+		col := &column{name: name, field: exported(name)}
+		if col.field == "" {
+			return nil, nil, fmt.Errorf("column %v: invalid name", name)
+		}
+		if fields[col.field] {
+			return nil, nil, fmt.Errorf("column %v: duplicate field %v", name, col.field)
+		}
+		fields[col.field] = true
+		if !strings.EqualFold(col.field, name) {
+			col.tags = append(col.tags, `col:"`+name+`"`)
+		}
+
+		opts := strings.Fields(types[i])
+		col.typ = opts[0]
+		if col.typ == "time" {
+			col.typ = "time.Time"
+		} else if col.typ == "*time" {
+			col.typ = "*time.Time"
+		}
+		if _, err := parser.ParseExpr(col.typ); err != nil {
+			return nil, nil, fmt.Errorf("column %v: invalid type %v", name, col.typ)
+		}
+
+		var rf []string
+		add := func(name string, unique bool) {
+			idx := byName[name]
+			if idx == nil {
+				idx = &index{name: name}
+				byName[name] = idx
+				indexes = append(indexes, idx)
+			}
+			idx.unique = idx.unique || unique
+			idx.fields = append(idx.fields, col)
+		}
+		for _, opt := range opts[1:] {
+			key, value := opt, ""
+			if eq := strings.Index(opt, "="); eq >= 0 {
+				key, value = opt[:eq], opt[eq+1:]
+			}
+			switch key {
+			case "index", "unique":
+				rf = append(rf, opt)
+				if value == "" {
+					add(col.field, key == "unique")
+				} else {
+					add(value, key == "unique")
+				}
+			case "ref", "range", "enum", "default":
+				col.tags = append(col.tags, key+":"+strconv.Quote(value))
+			default:
+				return nil, nil, fmt.Errorf("column %v: unknown option %v", name, opt)
+			}
+		}
+		if len(rf) > 0 {
+			col.tags = append([]string{`rf:"` + strings.Join(rf, ",") + `"`}, col.tags...)
+		}
+
+		columns = append(columns, col)
+	}
+
+	return columns, indexes, nil
+}
+
+func generate(file string, columns []*column, indexes []*index) ([]byte, error) {
+	t := *typeName
+	f := t + "File"
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by rfgen from %v; DO NOT EDIT.\n\n", file)
+	fmt.Fprintf(&b, "package %v\n\n", *pkg)
+	fmt.Fprintf(&b, "import (\n")
+	if *register != "" {
+		fmt.Fprintf(&b, "%q\n", "github.com/name5566/leaf/log")
+	}
+	fmt.Fprintf(&b, "%q\n", "github.com/name5566/leaf/recordfile")
+	for _, col := range columns {
+		if strings.Contains(col.typ, "time.") {
+			fmt.Fprintf(&b, "%q\n", "time")
+			break
+		}
+	}
+	fmt.Fprintf(&b, ")\n\n")
+
+	// struct
+	fmt.Fprintf(&b, "// %v is a record of %v\n", t, file)
+	fmt.Fprintf(&b, "type %v struct {\n", t)
+	for _, col := range columns {
+		fmt.Fprintf(&b, "%v %v", col.field, col.typ)
+		if len(col.tags) > 0 {
+			fmt.Fprintf(&b, " `%v`", strings.Join(col.tags, " "))
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+	fmt.Fprintf(&b, "}\n\n")
+
+	// file
+	fmt.Fprintf(&b, "// %v is a version of %v read into %v records\n", f, file, t)
+	fmt.Fprintf(&b, "type %v struct {\n*recordfile.RecordFile\n}\n\n", f)
+	fmt.Fprintf(&b, "func New%v(name string) (%v, error) {\n", f, f)
+	fmt.Fprintf(&b, "rf, err := recordfile.New(%v{})\n", t)
+	fmt.Fprintf(&b, "if err != nil {\nreturn %v{}, err\n}\n", f)
+	fmt.Fprintf(&b, "err = rf.Read(name)\n")
+	fmt.Fprintf(&b, "if err != nil {\nreturn %v{}, err\n}\n", f)
+	fmt.Fprintf(&b, "return %v{rf}, nil\n}\n\n", f)
+	fmt.Fprintf(&b, "func (f %v) Record(i int) *%v {\nreturn f.RecordFile.Record(i).(*%v)\n}\n\n", f, t, t)
+
+	// indexes
+	for _, idx := range indexes {
+		var params, args []string
+		for _, col := range idx.fields {
+			p := param(col.field)
+			params = append(params, p+" "+col.typ)
+			args = append(args, p)
+		}
+		if idx.unique {
+			fmt.Fprintf(&b, "func (f %v) GetBy%v(%v) *%v {\n", f, exported(idx.name), strings.Join(params, ", "), t)
+			fmt.Fprintf(&b, "r := f.Get(%q, %v)\n", idx.name, strings.Join(args, ", "))
+			fmt.Fprintf(&b, "if r == nil {\nreturn nil\n}\n")
+			fmt.Fprintf(&b, "return r.(*%v)\n}\n\n", t)
+		} else {
+			fmt.Fprintf(&b, "func (f %v) FindBy%v(%v) []*%v {\n", f, exported(idx.name), strings.Join(params, ", "), t)
+			fmt.Fprintf(&b, "rs := f.Find(%q, %v)\n", idx.name, strings.Join(args, ", "))
+			fmt.Fprintf(&b, "records := make([]*%v, len(rs))\n", t)
+			fmt.Fprintf(&b, "for i, r := range rs {\nrecords[i] = r.(*%v)\n}\n", t)
+			fmt.Fprintf(&b, "return records\n}\n\n")
+		}
+	}
+
+	// registry
+	if *register != "" {
+		v := param(t) + "Table"
+		fmt.Fprintf(&b, "var %v *recordfile.Table\n\n", v)
+		fmt.Fprintf(&b, "func init() {\n")
+		fmt.Fprintf(&b, "t, err := recordfile.Register(%q, %v{}, %q, nil)\n", *table, t, *register)
+		fmt.Fprintf(&b, "if err != nil {\nlog.Fatal(\"%%v\", err)\n}\n")
+		fmt.Fprintf(&b, "%v = t\n}\n\n", v)
+		fmt.Fprintf(&b, "// the current version of the table %v\n", *table)
+		fmt.Fprintf(&b, "// goroutine safe\n")
+		fmt.Fprintf(&b, "func %v() %v {\nreturn %v{%v.RecordFile()}\n}\n", exported(*table), f, f, v)
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format source error: %v", err)
+	}
+	return src, nil
+}
+
+// an exported identifier from a column name, e.g. ItemID from item_ID
+func exported(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteRune('X')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// a parameter name from a field name, e.g. itemID from ItemID
+func param(field string) string {
+	rs := []rune(field)
+	for i := 0; i < len(rs) && unicode.IsUpper(rs[i]); i++ {
+		if i > 0 && i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+			break
+		}
+		rs[i] = unicode.ToLower(rs[i])
+	}
+	p := string(rs)
+	if token.IsKeyword(p) || p == "f" || p == "r" || p == "rs" || p == "records" {
+		p += "_"
+	}
+	return p
+}
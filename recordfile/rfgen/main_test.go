@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rfgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	*pkg = "gamedata"
+	*typeName = "Item"
+	*register = "gamedata/items.txt"
+	*output = filepath.Join(dir, "item.go")
+	defer func() { *typeName, *register, *output = "", "", "" }()
+
+	err = run(filepath.Join("testdata", "items.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := ioutil.ReadFile(*output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "item.go.golden")
+	if *update {
+		err = ioutil.WriteFile(golden, src, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, expected) {
+		t.Fatalf("generated source differs from %v (go test -update to update it):\n%s", golden, src)
+	}
+}
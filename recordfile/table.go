@@ -0,0 +1,340 @@
+package recordfile
+
+import (
+	"fmt"
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/console"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// the function id called on subscribed servers with a *TableEvent
+const ChanRPCID = "TableReloaded"
+
+// a registered table, reloading reads and validates a new version of the
+// table and swaps it in, readers keep the version they got from RecordFile
+type Table struct {
+	name     string
+	st       interface{}
+	file     string
+	validate func(rf *RecordFile) error
+	rf       atomic.Value
+	version  int32
+}
+
+type TableEvent struct {
+	Name       string
+	Version    int
+	RecordFile *RecordFile
+}
+
+var (
+	tables       = make(map[string]*Table)
+	mutexTables  sync.RWMutex
+	mutexReload  sync.Mutex
+	servers      []*chanrpc.Server
+	mutexServers sync.Mutex
+)
+
+func init() {
+	console.RegisterFunc("table", "lists or reloads the registered tables", commandTable)
+	console.SetCompleter("table", completeTable)
+}
+
+// Register reads the table from file and registers it with name, validate
+// (may be nil) is called on every version read before it is used
+func Register(name string, st interface{}, file string, validate func(rf *RecordFile) error) (*Table, error) {
+	t := new(Table)
+	t.name = name
+	t.st = st
+	t.file = file
+	t.validate = validate
+
+	rf, err := t.read()
+	if err != nil {
+		return nil, err
+	}
+	t.rf.Store(rf)
+	t.version = 1
+
+	mutexTables.Lock()
+	defer mutexTables.Unlock()
+	if _, ok := tables[name]; ok {
+		return nil, fmt.Errorf("table %v: already registered", name)
+	}
+	tables[name] = t
+
+	return t, nil
+}
+
+// goroutine safe
+func Lookup(name string) *Table {
+	mutexTables.RLock()
+	defer mutexTables.RUnlock()
+	return tables[name]
+}
+
+// the server receives a *TableEvent via ChanRPCID after a table is reloaded
+// goroutine safe
+func Subscribe(server *chanrpc.Server) {
+	mutexServers.Lock()
+	servers = append(servers, server)
+	mutexServers.Unlock()
+}
+
+func (t *Table) Name() string {
+	return t.name
+}
+
+// the current version of the table
+// goroutine safe
+func (t *Table) RecordFile() *RecordFile {
+	return t.rf.Load().(*RecordFile)
+}
+
+// goroutine safe
+func (t *Table) Version() int {
+	return int(atomic.LoadInt32(&t.version))
+}
+
+func (t *Table) read() (*RecordFile, error) {
+	rf, err := New(t.st)
+	if err != nil {
+		return nil, fmt.Errorf("table %v: %v", t.name, err)
+	}
+	err = rf.Read(t.file)
+	if err != nil {
+		return nil, fmt.Errorf("table %v: %v: %v", t.name, t.file, err)
+	}
+	if t.validate != nil {
+		err = t.validate(rf)
+		if err != nil {
+			return nil, fmt.Errorf("table %v: %v: %v", t.name, t.file, err)
+		}
+	}
+	return rf, nil
+}
+
+// the current versions of the tables
+func currentSet() map[string]*RecordFile {
+	mutexTables.RLock()
+	defer mutexTables.RUnlock()
+
+	set := make(map[string]*RecordFile, len(tables))
+	for name, t := range tables {
+		set[name] = t.RecordFile()
+	}
+	return set
+}
+
+func validateSet(set map[string]*RecordFile) error {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		errs = append(errs, set[name].validate(set)...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("validate tables error:\n  %v", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// Validate checks the constraints (tags ref, range and enum) of all the
+// registered tables together, all violations are reported
+// goroutine safe
+func Validate() error {
+	mutexReload.Lock()
+	defer mutexReload.Unlock()
+
+	return validateSet(currentSet())
+}
+
+// swaps in rf, the event is sent by notify once the locks are released
+func (t *Table) swap(rf *RecordFile) *TableEvent {
+	t.rf.Store(rf)
+	version := atomic.AddInt32(&t.version, 1)
+
+	return &TableEvent{
+		Name:       t.name,
+		Version:    int(version),
+		RecordFile: rf,
+	}
+}
+
+// sends the events to the subscribed servers, without holding a lock as a
+// server may be waited for and its handler may reload tables
+func notify(events ...*TableEvent) {
+	mutexServers.Lock()
+	ss := append([]*chanrpc.Server(nil), servers...)
+	mutexServers.Unlock()
+
+	for _, e := range events {
+		for _, s := range ss {
+			s.Go(ChanRPCID, e)
+		}
+	}
+}
+
+// Reload reads a new version of the table, the current version is kept if
+// the new one could not be read or validated, or breaks the constraints
+// checked by Validate
+// goroutine safe
+func (t *Table) Reload() error {
+	e, err := t.reload()
+	if err != nil {
+		return err
+	}
+	notify(e)
+	return nil
+}
+
+func (t *Table) reload() (*TableEvent, error) {
+	mutexReload.Lock()
+	defer mutexReload.Unlock()
+
+	rf, err := t.read()
+	if err != nil {
+		return nil, err
+	}
+
+	// the tables referring to the table are checked too
+	set := currentSet()
+	set[t.name] = rf
+	err = validateSet(set)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.swap(rf), nil
+}
+
+// ReloadAll reads new versions of all tables and swaps them in only if every
+// table could be read and validated and the constraints checked by Validate
+// hold. The events are sent once all the tables are swapped in
+// goroutine safe
+func ReloadAll() error {
+	events, err := reloadAll()
+	if err != nil {
+		return err
+	}
+	notify(events...)
+	return nil
+}
+
+func reloadAll() ([]*TableEvent, error) {
+	mutexReload.Lock()
+	defer mutexReload.Unlock()
+
+	ts := sortedTables()
+	rfs := make([]*RecordFile, len(ts))
+	var errs []string
+	for i, t := range ts {
+		rf, err := t.read()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		rfs[i] = rf
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("reload tables error:\n  %v", strings.Join(errs, "\n  "))
+	}
+
+	set := make(map[string]*RecordFile, len(ts))
+	for i, t := range ts {
+		set[t.name] = rfs[i]
+	}
+	err := validateSet(set)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*TableEvent, len(ts))
+	for i, t := range ts {
+		events[i] = t.swap(rfs[i])
+	}
+	return events, nil
+}
+
+func sortedTables() []*Table {
+	mutexTables.RLock()
+	ts := make([]*Table, 0, len(tables))
+	for _, t := range tables {
+		ts = append(ts, t)
+	}
+	mutexTables.RUnlock()
+
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].name < ts[j].name
+	})
+	return ts
+}
+
+// console command
+func commandTableUsage() string {
+	return "table manages the registered recordfile tables\r\n\r\n" +
+		"Usage: table list|reload\r\n" +
+		"  list          - lists the tables and their versions\r\n" +
+		"  reload        - reloads all tables\r\n" +
+		"  reload name   - reloads one table"
+}
+
+func completeTable(args []string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"list", "reload"}
+	case len(args) == 1 && args[0] == "reload":
+		var names []string
+		for _, t := range sortedTables() {
+			names = append(names, t.name)
+		}
+		return names
+	default:
+		return nil
+	}
+}
+
+func commandTable(args []string) string {
+	if len(args) == 0 {
+		return commandTableUsage()
+	}
+
+	switch args[0] {
+	case "list":
+		var lines []string
+		for _, t := range sortedTables() {
+			lines = append(lines, t.name+" - "+t.file+
+				", version: "+strconv.Itoa(t.Version())+
+				", records: "+strconv.Itoa(t.RecordFile().NumRecord()))
+		}
+		return strings.Join(lines, "\r\n")
+	case "reload":
+		var err error
+		switch len(args) {
+		case 1:
+			err = ReloadAll()
+		case 2:
+			t := Lookup(args[1])
+			if t == nil {
+				return "table " + args[1] + " not registered"
+			}
+			err = t.Reload()
+		default:
+			return commandTableUsage()
+		}
+		if err != nil {
+			return strings.Replace(err.Error(), "\n", "\r\n", -1)
+		}
+		return "ok"
+	default:
+		return commandTableUsage()
+	}
+}
@@ -0,0 +1,61 @@
+package recordfile_test
+
+import (
+	"github.com/name5566/leaf/chanrpc"
+	"github.com/name5566/leaf/recordfile"
+	"testing"
+	"time"
+)
+
+func TestReloadFullSubscriber(t *testing.T) {
+	type Item struct {
+		ID    int `rf:"index,unique"`
+		Type  int
+		Level int
+		Class int
+		Name  string
+	}
+
+	table, err := recordfile.Register("reload_items", Item{}, "items.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue of the subscriber is full while the table is reloaded, and
+	// the call being executed validates the tables
+	s := chanrpc.NewServer(1)
+	ready := make(chan bool)
+	s.Register("validate", func(args []interface{}) {
+		<-ready
+		recordfile.Validate()
+	})
+	s.Register("noop", func(args []interface{}) {})
+	s.Register(recordfile.ChanRPCID, func(args []interface{}) {})
+	recordfile.Subscribe(s)
+
+	done := make(chan bool)
+	s.Go("validate")
+	go func() {
+		for i := 0; i < 3; i++ {
+			s.Exec(<-s.ChanCall)
+		}
+		close(done)
+	}()
+	s.Go("noop")
+
+	reloaded := make(chan error, 1)
+	go func() {
+		reloaded <- table.Reload()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(ready)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+	if err := <-reloaded; err != nil {
+		t.Fatal(err)
+	}
+}
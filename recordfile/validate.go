@@ -0,0 +1,185 @@
+package recordfile
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// constraints of a field, checked by Validate. For arrays and slices every
+// element is checked, nil pointers are not checked
+//
+// ref:"items.ID"  - the value must be found by the index ID of the table items
+// range:"1,100"   - the value must be in [1, 100], either bound may be empty
+// enum:"1|2|3"    - the value must be one of 1, 2 and 3
+type check struct {
+	field    int
+	name     string
+	refTable string
+	refIndex string
+	hasMin   bool
+	min      float64
+	hasMax   bool
+	max      float64
+	enum     []string
+}
+
+func parseChecks(typeRecord reflect.Type) ([]check, error) {
+	var checks []check
+	for i := 0; i < typeRecord.NumField(); i++ {
+		f := typeRecord.Field(i)
+		c := check{field: i, name: f.Name}
+		ok := false
+
+		if ref := f.Tag.Get("ref"); ref != "" {
+			dot := strings.LastIndex(ref, ".")
+			if dot <= 0 || dot == len(ref)-1 {
+				return nil, fmt.Errorf("field %v %v: invalid ref %q (table.index)", i, f.Name, ref)
+			}
+			c.refTable = ref[:dot]
+			c.refIndex = ref[dot+1:]
+			ok = true
+		}
+
+		if r := f.Tag.Get("range"); r != "" {
+			bounds := strings.Split(r, ",")
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("field %v %v: invalid range %q (min,max)", i, f.Name, r)
+			}
+			var err error
+			if s := strings.TrimSpace(bounds[0]); s != "" {
+				c.hasMin = true
+				c.min, err = strconv.ParseFloat(s, 64)
+			}
+			if s := strings.TrimSpace(bounds[1]); s != "" && err == nil {
+				c.hasMax = true
+				c.max, err = strconv.ParseFloat(s, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("field %v %v: invalid range %q: %v", i, f.Name, r, err)
+			}
+			t := f.Type
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			if t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+				t = t.Elem()
+			}
+			if _, numeric := toFloat(reflect.Zero(t)); !numeric {
+				return nil, fmt.Errorf("field %v %v: range not supported by %v", i, f.Name, f.Type)
+			}
+			ok = true
+		}
+
+		if e := f.Tag.Get("enum"); e != "" {
+			c.enum = strings.Split(e, "|")
+			ok = true
+		}
+
+		if ok && f.PkgPath != "" {
+			return nil, fmt.Errorf("field %v %v: could not check unexported field", i, f.Name)
+		}
+		if ok {
+			checks = append(checks, c)
+		}
+	}
+	return checks, nil
+}
+
+// the values of a field, the elements for arrays and slices
+func values(field reflect.Value) []reflect.Value {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+	switch field.Kind() {
+	case reflect.Array, reflect.Slice:
+		vs := make([]reflect.Value, field.Len())
+		for i := range vs {
+			vs[i] = field.Index(i)
+		}
+		return vs
+	default:
+		return []reflect.Value{field}
+	}
+}
+
+func toFloat(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// validate checks the constraints of rf against the tables of set
+func (rf *RecordFile) validate(set map[string]*RecordFile) []string {
+	var errs []string
+	for n, r := range rf.records {
+		record := reflect.ValueOf(r).Elem()
+		for _, c := range rf.checks {
+			for _, v := range values(record.Field(c.field)) {
+				msg := c.check(v, set)
+				if msg != "" {
+					errs = append(errs, fmt.Sprintf("%v (%v) %v: %v",
+						rf.file, rf.cell(rf.rows[n], rf.columns[c.field], c.field), c.name, msg))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func (c *check) check(v reflect.Value, set map[string]*RecordFile) string {
+	if c.hasMin || c.hasMax {
+		f, _ := toFloat(v)
+		if c.hasMin && f < c.min || c.hasMax && f > c.max {
+			return fmt.Sprintf("%v out of range [%v, %v]", v.Interface(), c.bound(c.hasMin, c.min), c.bound(c.hasMax, c.max))
+		}
+	}
+
+	if c.enum != nil {
+		s := fmt.Sprint(v.Interface())
+		found := false
+		for _, e := range c.enum {
+			if s == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("%v not in %v", s, strings.Join(c.enum, "|"))
+		}
+	}
+
+	if c.refTable != "" {
+		target := set[c.refTable]
+		if target == nil {
+			return fmt.Sprintf("table %v not registered", c.refTable)
+		}
+		idx := target.named[c.refIndex]
+		if idx == nil || len(idx.fields) != 1 {
+			return fmt.Sprintf("table %v has no single field index %v", c.refTable, c.refIndex)
+		}
+		if len(target.lookup(c.refIndex, []interface{}{v.Interface()})) == 0 {
+			return fmt.Sprintf("%v not found in %v.%v", v.Interface(), c.refTable, c.refIndex)
+		}
+	}
+
+	return ""
+}
+
+func (c *check) bound(ok bool, f float64) string {
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,75 @@
+package recordfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePosition(t *testing.T) {
+	type Goods struct {
+		ID    int `rf:"index,unique"`
+		Price int `range:"1,"`
+		Stock int `range:"1," default:"0"`
+	}
+
+	dir, err := ioutil.TempDir("", "recordfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"goods.txt": "ID\tPrice\n" +
+			"# the price of every item\n" +
+			"1\t5\n" +
+			"2\t0\n",
+		"goods.json": "[\n" +
+			"  {\"ID\": 1, \"Price\": 5},\n" +
+			"\n" +
+			"  {\"ID\": 2,\n" +
+			"   \"Price\": 0}\n" +
+			"]\n",
+	}
+	expected := map[string][]string{
+		"goods.txt": {
+			"(line=3, column Stock not in the file) Stock: 0 out of range [1, ]",
+			"(line=4, col=1) Price: 0 out of range [1, ]",
+			"(line=4, column Stock not in the file) Stock: 0 out of range [1, ]",
+		},
+		"goods.json": {
+			"(line=2, column Stock not in the file) Stock: 0 out of range [1, ]",
+			"(line=4, col=1) Price: 0 out of range [1, ]",
+			"(line=4, column Stock not in the file) Stock: 0 out of range [1, ]",
+		},
+	}
+
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		err := ioutil.WriteFile(file, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rf, err := New(Goods{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rf.Mapping = MapByName
+		err = rf.Read(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errs := rf.validate(nil)
+		var want []string
+		for _, e := range expected[name] {
+			want = append(want, file+" "+e)
+		}
+		if strings.Join(errs, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%v errors:\n%v\nexpected:\n%v", name, strings.Join(errs, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package recordfile
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the parts of the Office Open XML spreadsheet format read by readXLSX
+
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t *xlsxText) String() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+	var s string
+	for _, r := range t.R {
+		s += r.T
+	}
+	return s
+}
+
+type xlsxSST struct {
+	SI []xlsxText `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string   `xml:"r,attr"`
+			S  int      `xml:"s,attr"`
+			T  string   `xml:"t,attr"`
+			V  string   `xml:"v"`
+			IS xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%v not found", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// the column of a cell reference, e.g. 2 for C7
+func xlsxColumn(ref string) (int, error) {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A') + 1
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// whether a number format shows a date or a time: the built-in formats
+// 14-22, 45-47 and the East Asian ones 27-36, 50-58, or a format code with
+// date or time parts outside quoted text and brackets
+func xlsxDateFormat(id int, code string) bool {
+	switch {
+	case id >= 14 && id <= 22, id >= 27 && id <= 36, id >= 45 && id <= 47, id >= 50 && id <= 58:
+		return true
+	case code == "":
+		return false
+	}
+
+	quoted := false
+	bracket := false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\':
+			i++
+		case c == '[':
+			bracket = true
+		case c == ']':
+			bracket = false
+		case bracket:
+		case strings.IndexByte("yYmMdDhHsS", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// the date and time formats of the cell styles
+func xlsxDateStyles(styles *xlsxStyles) []bool {
+	codes := make(map[int]string)
+	for _, f := range styles.NumFmts {
+		codes[f.ID] = f.Code
+	}
+	dates := make([]bool, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		dates[i] = xlsxDateFormat(xf.NumFmtID, codes[xf.NumFmtID])
+	}
+	return dates
+}
+
+// the text of a date serial number, read by the time.Time fields, e.g.
+// 2024-03-01 or 2024-05-01 10:00:00
+func xlsxDate(v string, date1904 bool) string {
+	serial, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	t := epoch.Add(time.Duration(math.Round(serial*86400)) * time.Second)
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// readXLSX reads the cells of a sheet (the first one if sheet is empty) as
+// text, the numbers formatted as dates as the text of a date, and the row
+// number of every line. Empty rows and rows starting with comment (if
+// positive) are skipped
+func readXLSX(name string, sheet string, comment rune) (lines [][]string, nums []int, err error) {
+	z, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer z.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	// sheet
+	var wb xlsxWorkbook
+	err = readZipXML(files, "xl/workbook.xml", &wb)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, nil, errors.New("no sheet found")
+	}
+	rid := ""
+	for _, s := range wb.Sheets {
+		if sheet == "" || s.Name == sheet {
+			rid = s.RID
+			break
+		}
+	}
+	if rid == "" {
+		return nil, nil, fmt.Errorf("sheet %v not found", sheet)
+	}
+
+	var rels xlsxRelationships
+	err = readZipXML(files, "xl/_rels/workbook.xml.rels", &rels)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := ""
+	for _, r := range rels.Relationships {
+		if r.ID == rid {
+			target = r.Target
+			break
+		}
+	}
+	if target == "" {
+		return nil, nil, fmt.Errorf("sheet %v not found", rid)
+	}
+	if strings.HasPrefix(target, "/") {
+		target = target[1:]
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	// shared strings
+	var sst xlsxSST
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		err = readZipXML(files, "xl/sharedStrings.xml", &sst)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// date formats
+	var dates []bool
+	if _, ok := files["xl/styles.xml"]; ok {
+		var styles xlsxStyles
+		err = readZipXML(files, "xl/styles.xml", &styles)
+		if err != nil {
+			return nil, nil, err
+		}
+		dates = xlsxDateStyles(&styles)
+	}
+	date1904 := wb.Properties.Date1904 == "1" || wb.Properties.Date1904 == "true"
+
+	var ws xlsxSheet
+	err = readZipXML(files, target, &ws)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	num := 0
+	for _, row := range ws.Rows {
+		// a row without number follows the previous one
+		num++
+		if row.R > 0 {
+			num = row.R
+		}
+		var line []string
+		col := -1
+		for _, c := range row.Cells {
+			// a cell without reference follows the previous one
+			col++
+			if c.R != "" {
+				col, err = xlsxColumn(c.R)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			for len(line) <= col {
+				line = append(line, "")
+			}
+
+			switch c.T {
+			case "s":
+				i, err := strconv.Atoi(c.V)
+				if err != nil || i < 0 || i >= len(sst.SI) {
+					return nil, nil, fmt.Errorf("invalid shared string %q at %v", c.V, c.R)
+				}
+				line[col] = sst.SI[i].String()
+			case "inlineStr":
+				line[col] = c.IS.String()
+			case "b":
+				line[col] = strconv.FormatBool(c.V == "1")
+			case "", "n":
+				if c.S >= 0 && c.S < len(dates) && dates[c.S] {
+					line[col] = xlsxDate(c.V, date1904)
+				} else {
+					line[col] = c.V
+				}
+			default:
+				line[col] = c.V
+			}
+		}
+
+		if len(line) == 0 || strings.TrimSpace(strings.Join(line, "")) == "" {
+			continue
+		}
+		if comment > 0 && strings.HasPrefix(line[0], string(comment)) {
+			continue
+		}
+		lines = append(lines, line)
+		nums = append(nums, num)
+	}
+
+	return lines, nums, nil
+}
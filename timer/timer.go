@@ -3,10 +3,18 @@ package timer
 import (
 	"github.com/name5566/leaf/conf"
 	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/metrics"
 	"runtime"
 	"time"
 )
 
+var (
+	timersStarted = metrics.NewCounter("leaf_timers_started_total", "Timers started by AfterFunc and CronFunc.")
+	timersFired   = metrics.NewCounter("leaf_timers_fired_total", "Timers fired and queued to their dispatcher.")
+	timersStopped = metrics.NewCounter("leaf_timers_stopped_total", "Timers stopped before they fired.")
+	timersPending = metrics.NewGauge("leaf_timers_pending", "Timers started which have neither fired nor been stopped.")
+)
+
 // one dispatcher per goroutine (goroutine not safe)
 type Dispatcher struct {
 	ChanTimer chan *Timer
@@ -25,7 +33,10 @@ type Timer struct {
 }
 
 func (t *Timer) Stop() {
-	t.t.Stop()
+	if t.t.Stop() {
+		timersStopped.Inc()
+		timersPending.Dec()
+	}
 	t.cb = nil
 }
 
@@ -51,7 +62,11 @@ func (t *Timer) Cb() {
 func (disp *Dispatcher) AfterFunc(d time.Duration, cb func()) *Timer {
 	t := new(Timer)
 	t.cb = cb
+	timersStarted.Inc()
+	timersPending.Inc()
 	t.t = time.AfterFunc(d, func() {
+		timersFired.Inc()
+		timersPending.Dec()
 		disp.ChanTimer <- t
 	})
 	return t
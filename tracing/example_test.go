@@ -0,0 +1,71 @@
+package tracing_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/tracing"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func Example() {
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	conf.TraceFile = filepath.Join(dir, "spans.json")
+	tracing.Init()
+
+	// the routing of a message by the gate and the chanrpc call handling it
+	span := tracing.Start("gate route Hello")
+	span.SetKind(tracing.KindServer)
+	call := span.Child("chanrpc Hello")
+	call.SetKind(tracing.KindConsumer)
+	call.SetAttr("user", 42)
+	span.End()
+	call.End()
+
+	// another server continuing the trace, from a traceparent sent by the game
+	remote := tracing.StartRemote("remote Hello", span.Traceparent())
+	fmt.Println(remote.TraceID() == span.TraceID())
+	remote.End()
+
+	tracing.Destroy()
+	conf.TraceFile = ""
+
+	// one OTLP/JSON export request per line
+	f, err := os.Open(filepath.Join(dir, "spans.json"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []struct {
+						Name         string
+						ParentSpanID string
+						Kind         int
+					}
+				}
+			}
+		}
+		json.Unmarshal(scanner.Bytes(), &r)
+		for _, s := range r.ResourceSpans[0].ScopeSpans[0].Spans {
+			fmt.Println(s.Name, s.ParentSpanID != "", s.Kind)
+		}
+	}
+
+	// Output:
+	// true
+	// gate route Hello false 2
+	// chanrpc Hello true 5
+	// remote Hello true 1
+}
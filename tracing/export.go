@@ -0,0 +1,272 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/name5566/leaf/conf"
+	"github.com/name5566/leaf/log"
+	"github.com/name5566/leaf/metrics"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// the spans queued for export, the spans ended while the queue is full
+	// are dropped
+	lenChanSpan = 4096
+	// the spans exported in one request
+	maxBatch      = 512
+	batchInterval = time.Second
+)
+
+var (
+	// 1 between Init and Destroy
+	enabled  int32
+	chanSpan = make(chan *Span, lenChanSpan)
+	closeSig chan bool
+	done     chan bool
+
+	file      *os.File
+	client    *http.Client
+	collector string
+	resource  resourceInfo
+
+	spansExported = metrics.NewCounter("leaf_tracing_spans_exported_total", "Spans exported.")
+	spansDropped  = metrics.NewCounter("leaf_tracing_spans_dropped_total", "Spans dropped because the export queue was full.")
+)
+
+// Init starts the exporter if conf.TraceFile or conf.TraceCollector is set,
+// the spans are not recorded before
+func Init() {
+	InitConfig(conf.Default())
+}
+
+// InitConfig starts the exporter if c.TraceFile or c.TraceCollector is set
+func InitConfig(c *conf.Config) {
+	if c.TraceFile == "" && c.TraceCollector == "" {
+		return
+	}
+
+	if c.TraceFile != "" {
+		f, err := os.OpenFile(c.TraceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatal("%v", err)
+		}
+		file = f
+	}
+	if c.TraceCollector != "" {
+		client = &http.Client{Timeout: 10 * time.Second}
+		collector = c.TraceCollector
+	}
+
+	name := c.TraceServiceName
+	if name == "" {
+		name = "unknown_service:" + filepath.Base(os.Args[0])
+	}
+	resource.Attributes = []keyValue{{Key: "service.name", Value: anyValue{StringValue: &name}}}
+
+	SetSampleRate(c.TraceSampleRate)
+	closeSig = make(chan bool)
+	done = make(chan bool)
+	go run()
+	atomic.StoreInt32(&enabled, 1)
+}
+
+// Destroy exports the spans ended before and stops the exporter
+func Destroy() {
+	if atomic.LoadInt32(&enabled) == 0 {
+		return
+	}
+	atomic.StoreInt32(&enabled, 0)
+
+	close(closeSig)
+	<-done
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+	client = nil
+	collector = ""
+}
+
+// goroutine safe
+func export(s *Span) {
+	select {
+	case chanSpan <- s:
+	default:
+		spansDropped.Inc()
+	}
+}
+
+func run() {
+	defer close(done)
+
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case s := <-chanSpan:
+			batch = append(batch, s)
+			if len(batch) >= maxBatch {
+				write(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				write(batch)
+				batch = nil
+			}
+		case <-closeSig:
+			for {
+				select {
+				case s := <-chanSpan:
+					batch = append(batch, s)
+				default:
+					for len(batch) > 0 {
+						n := len(batch)
+						if n > maxBatch {
+							n = maxBatch
+						}
+						write(batch[:n])
+						batch = batch[n:]
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// writes an OTLP/JSON export request
+func write(batch []*Span) {
+	spans := make([]span, len(batch))
+	for i, s := range batch {
+		s.mutex.Lock()
+		kind := s.kind
+		if kind == 0 {
+			kind = KindInternal
+		}
+		spans[i] = span{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              int(kind),
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        s.attrs,
+			Status:            s.status,
+		}
+		if s.parentID != [8]byte{} {
+			spans[i].ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		s.mutex.Unlock()
+	}
+
+	data, err := json.Marshal(&exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource,
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: "github.com/name5566/leaf"},
+				Spans: spans,
+			}},
+		}},
+	})
+	if err != nil {
+		log.Error("tracing: %v", err)
+		return
+	}
+
+	if file != nil {
+		_, err := file.Write(append(data, '\n'))
+		if err != nil {
+			log.Error("tracing: %v", err)
+		}
+	}
+	if client != nil {
+		err := post(data)
+		if err != nil {
+			log.Error("tracing: export %v spans to %v: %v", len(spans), collector, err)
+		}
+	}
+	spansExported.Add(float64(len(spans)))
+}
+
+func post(data []byte) error {
+	resp, err := client.Post(collector, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP status %v", resp.Status)
+	}
+	return nil
+}
+
+// the OTLP/JSON encoding of the spans, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resourceInfo `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resourceInfo struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// one of the values is set, IntValue is an int64 in decimal
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    string   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+const statusError = 2
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
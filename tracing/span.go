@@ -0,0 +1,275 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	mrand "math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span is a timed operation of a trace, e.g. the routing of a message by
+// the gate or a chanrpc call. A nil *Span is an untraced operation: its
+// methods do nothing and its children are nil, so the code passing spans on
+// does not check whether tracing is enabled
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+
+	mutex  sync.Mutex
+	kind   Kind
+	end    time.Time
+	attrs  []keyValue
+	status status
+	ended  bool
+}
+
+// Kind is the role of a span in a trace, the OpenTelemetry span kinds
+type Kind int
+
+const (
+	// an operation inside a server, the default
+	KindInternal Kind = iota + 1
+	// the handling of a request of a client, e.g. the routing of a message
+	// received by the gate or a chanrpc call returning its result
+	KindServer
+	// a request to a server
+	KindClient
+	// a message sent without waiting for its handling
+	KindProducer
+	// the handling of a message of a producer, e.g. a chanrpc Go
+	KindConsumer
+)
+
+// the fraction of the root spans recorded, as float64 bits
+var sampleRate uint64
+
+// SetSampleRate sets the fraction in [0, 1] of the traces recorded,
+// the TraceSampleRate setting is applied by Init
+// goroutine safe
+func SetSampleRate(rate float64) {
+	atomic.StoreUint64(&sampleRate, math.Float64bits(rate))
+}
+
+// Start starts a trace, it returns nil if tracing is disabled or the trace
+// is not sampled
+// goroutine safe
+func Start(name string) *Span {
+	if atomic.LoadInt32(&enabled) == 0 {
+		return nil
+	}
+	rate := math.Float64frombits(atomic.LoadUint64(&sampleRate))
+	if rate < 1 && mrand.Float64() >= rate {
+		return nil
+	}
+
+	s := newSpan(name)
+	randRead(s.traceID[:])
+	return s
+}
+
+// Child starts a span of the same trace, e.g. for the work started by the
+// operation of s
+// goroutine safe
+func (s *Span) Child(name string) *Span {
+	if s == nil || atomic.LoadInt32(&enabled) == 0 {
+		return nil
+	}
+
+	c := newSpan(name)
+	c.traceID = s.traceID
+	c.parentID = s.spanID
+	return c
+}
+
+// StartRemote continues a trace started by another process, see
+// Traceparent. It returns nil if tracing is disabled, if traceparent is
+// invalid or if the trace is not sampled
+// goroutine safe
+func StartRemote(name string, traceparent string) *Span {
+	if atomic.LoadInt32(&enabled) == 0 {
+		return nil
+	}
+	traceID, parentID, sampled, err := parseTraceparent(traceparent)
+	if err != nil || !sampled {
+		return nil
+	}
+
+	s := newSpan(name)
+	s.traceID = traceID
+	s.parentID = parentID
+	return s
+}
+
+func newSpan(name string) *Span {
+	s := new(Span)
+	s.name = name
+	s.start = time.Now()
+	randRead(s.spanID[:])
+	return s
+}
+
+func randRead(b []byte) {
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		// all zero IDs are invalid
+		for _, c := range b {
+			if c != 0 {
+				return
+			}
+		}
+	}
+}
+
+// SetAttr sets an attribute of the span, the value is a string, a bool, an
+// integer or a float, other values are formatted with fmt.Sprint. The
+// attributes set after End are ignored
+// goroutine safe
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	var v anyValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		v.IntValue = strconv.FormatInt(int64(value), 10)
+	case int32:
+		v.IntValue = strconv.FormatInt(int64(value), 10)
+	case int64:
+		v.IntValue = strconv.FormatInt(value, 10)
+	case uint32:
+		v.IntValue = strconv.FormatUint(uint64(value), 10)
+	case float32:
+		f := float64(value)
+		v.DoubleValue = &f
+	case float64:
+		v.DoubleValue = &value
+	default:
+		str := fmt.Sprint(value)
+		v.StringValue = &str
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ended {
+		return
+	}
+	for i := range s.attrs {
+		if s.attrs[i].Key == key {
+			s.attrs[i].Value = v
+			return
+		}
+	}
+	s.attrs = append(s.attrs, keyValue{Key: key, Value: v})
+}
+
+// SetError marks the span as failed, before End
+// goroutine safe
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	if !s.ended {
+		s.status = status{Code: statusError, Message: err.Error()}
+	}
+	s.mutex.Unlock()
+}
+
+// SetKind sets the kind of the span, before End
+// goroutine safe
+func (s *Span) SetKind(kind Kind) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	if !s.ended {
+		s.kind = kind
+	}
+	s.mutex.Unlock()
+}
+
+// End ends the span and queues it for export, the calls after the first
+// one do nothing
+// goroutine safe
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mutex.Unlock()
+
+	export(s)
+}
+
+// the trace ID in hex, empty for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// Traceparent returns the W3C traceparent of the span, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01, passed with the
+// messages sent to another process to continue the trace with StartRemote.
+// It returns an empty string for a nil span
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+func parseTraceparent(traceparent string) (traceID [16]byte, parentID [8]byte, sampled bool, err error) {
+	if len(traceparent) < 55 || traceparent[2] != '-' || traceparent[35] != '-' || traceparent[52] != '-' {
+		err = errors.New("invalid traceparent")
+		return
+	}
+	version, err := hex.DecodeString(traceparent[:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(traceparent) != 55) ||
+		(len(traceparent) > 55 && traceparent[55] != '-') {
+		err = errors.New("invalid traceparent version")
+		return
+	}
+	if _, err = hex.Decode(traceID[:], []byte(traceparent[3:35])); err != nil {
+		return
+	}
+	if _, err = hex.Decode(parentID[:], []byte(traceparent[36:52])); err != nil {
+		return
+	}
+	if traceID == [16]byte{} || parentID == [8]byte{} {
+		err = errors.New("invalid traceparent IDs")
+		return
+	}
+	flags, err := hex.DecodeString(traceparent[53:55])
+	if err != nil {
+		return
+	}
+	sampled = flags[0]&1 != 0
+	return
+}